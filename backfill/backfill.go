@@ -0,0 +1,182 @@
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/getsynq/synq-dbt/dbt"
+	"github.com/sirupsen/logrus"
+)
+
+// UploadFunc uploads the artifacts of one invocation.
+type UploadFunc func(ctx context.Context, invocation *Invocation, artifacts *dbt.Artifacts) error
+
+// Options configures Run.
+type Options struct {
+	// Root is the directory searched for artifact sets.
+	Root string
+	// StateFile records uploaded invocations so an interrupted backfill
+	// resumes where it stopped. No progress is kept when empty.
+	StateFile string
+	// Interval is the minimum time between the start of two uploads.
+	Interval time.Duration
+	// DryRun lists what would be uploaded without uploading.
+	DryRun bool
+}
+
+// Summary is the outcome of Run.
+type Summary struct {
+	Uploaded        []string
+	AlreadyUploaded []string
+	Failed          map[string]string
+	Skipped         []string
+}
+
+// Log prints the summary.
+func (s *Summary) Log() {
+	logrus.Infof(
+		"synq-dbt backfill finished: %d uploaded, %d already uploaded, %d failed, %d skipped",
+		len(s.Uploaded),
+		len(s.AlreadyUploaded),
+		len(s.Failed),
+		len(s.Skipped),
+	)
+	for _, skipped := range s.Skipped {
+		logrus.Warnf("synq-dbt backfill skipped %s", skipped)
+	}
+	failed := make([]string, 0, len(s.Failed))
+	for invocationId := range s.Failed {
+		failed = append(failed, invocationId)
+	}
+	sort.Strings(failed)
+	for _, invocationId := range failed {
+		logrus.Errorf("synq-dbt backfill failed invocation_id=`%s`: %s", invocationId, s.Failed[invocationId])
+	}
+}
+
+// Run discovers all invocations below options.Root and uploads them oldest
+// first. Invocations recorded in the state file are not uploaded again.
+func Run(ctx context.Context, options Options, upload UploadFunc) (*Summary, error) {
+	locations, err := Discover(options.Root)
+	if err != nil {
+		return nil, err
+	}
+	invocations, skipped := Index(ctx, locations)
+	logrus.Infof("synq-dbt backfill found %d invocations in %d artifact sets", len(invocations), len(locations))
+
+	state, err := loadState(options.StateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &Summary{Failed: map[string]string{}, Skipped: skipped}
+	var lastUpload time.Time
+	for i, invocation := range invocations {
+		if ctx.Err() != nil {
+			return summary, ctx.Err()
+		}
+
+		if _, done := state.Uploaded[invocation.InvocationId]; done {
+			summary.AlreadyUploaded = append(summary.AlreadyUploaded, invocation.InvocationId)
+			continue
+		}
+
+		logrus.Infof(
+			"synq-dbt backfill [%d/%d] invocation_id=`%s` generated_at=%s from %v",
+			i+1,
+			len(invocations),
+			invocation.InvocationId,
+			invocation.GeneratedAt.Format(time.RFC3339),
+			invocation.Locations(),
+		)
+		if options.DryRun {
+			continue
+		}
+
+		if wait := options.Interval - time.Since(lastUpload); !lastUpload.IsZero() && wait > 0 {
+			select {
+			case <-ctx.Done():
+				return summary, ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		lastUpload = time.Now()
+
+		artifacts, err := invocation.Load(ctx)
+		if err == nil {
+			err = upload(ctx, invocation, artifacts)
+		}
+		if err != nil {
+			summary.Failed[invocation.InvocationId] = err.Error()
+			continue
+		}
+
+		summary.Uploaded = append(summary.Uploaded, invocation.InvocationId)
+		state.Uploaded[invocation.InvocationId] = time.Now().UTC().Format(time.RFC3339)
+		if err := state.save(); err != nil {
+			return summary, fmt.Errorf("saving backfill state: %w", err)
+		}
+	}
+
+	return summary, nil
+}
+
+// state is the progress of a backfill, persisted as JSON.
+type state struct {
+	path string
+	// Uploaded maps invocation_id to the time it was uploaded.
+	Uploaded map[string]string `json:"uploaded"`
+}
+
+func loadState(path string) (*state, error) {
+	s := &state{path: path, Uploaded: map[string]string{}}
+	if path == "" {
+		return s, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, s); err != nil {
+		return nil, fmt.Errorf("%s is not a backfill state file: %w", path, err)
+	}
+	if s.Uploaded == nil {
+		s.Uploaded = map[string]string{}
+	}
+	return s, nil
+}
+
+// save replaces the state file atomically, so an interrupted backfill never
+// leaves it truncated.
+func (s *state) save() error {
+	if s.path == "" {
+		return nil
+	}
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,154 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/getsynq/synq-dbt/dbt"
+)
+
+func artifactJson(invocationId, generatedAt string) string {
+	return `{"metadata": {"invocation_id": "` + invocationId + `", "generated_at": "` + generatedAt + `"}}`
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// archiveRoot lays out three runs the way CI artifact storage tends to:
+// one directory per build, one of them holding a stale run_results.json from
+// the run before, plus a duplicate copy of the oldest run.
+func archiveRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "2024-05-03/target/manifest.json"), artifactJson("c", "2024-05-03T10:00:00Z"))
+	writeFile(t, filepath.Join(root, "2024-05-03/target/run_results.json"), artifactJson("b", "2024-05-02T10:05:00Z"))
+	writeFile(t, filepath.Join(root, "2024-05-03/target/compiled/p/model.sql"), "select 1")
+	writeFile(t, filepath.Join(root, "2024-05-02/target/manifest.json"), artifactJson("b", "2024-05-02T10:00:00Z"))
+	writeFile(t, filepath.Join(root, "2024-05-01/manifest.json"), artifactJson("a", "2024-05-01T10:00:00Z"))
+	writeFile(t, filepath.Join(root, "2024-05-01/run_results.json"), artifactJson("a", "2024-05-01T10:05:00Z"))
+	writeFile(t, filepath.Join(root, "copy/2024-05-01/run_results.json"), artifactJson("a", "2024-05-01T10:05:00Z"))
+	writeFile(t, filepath.Join(root, "broken/manifest.json"), "{")
+	writeFile(t, filepath.Join(root, ".cache/manifest.json"), artifactJson("hidden", "2024-05-04T10:00:00Z"))
+	return root
+}
+
+func TestDiscover(t *testing.T) {
+	root := archiveRoot(t)
+	locations, err := Discover(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, location := range locations {
+		rel, _ := filepath.Rel(root, location)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	want := []string{"2024-05-01", "2024-05-02/target", "2024-05-03/target", "broken", "copy/2024-05-01"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Discover() = %v, want %v", got, want)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	root := archiveRoot(t)
+	locations, err := Discover(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invocations, skipped := Index(context.Background(), locations)
+
+	var ids []string
+	for _, invocation := range invocations {
+		ids = append(ids, invocation.InvocationId)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("invocations = %v, want %v (oldest first)", ids, want)
+	}
+
+	b := invocations[1]
+	want := map[string]string{
+		"manifest.json":    filepath.Join(root, "2024-05-02/target"),
+		"run_results.json": filepath.Join(root, "2024-05-03/target"),
+	}
+	if !reflect.DeepEqual(b.Files, want) {
+		t.Errorf("invocation b files = %v, want %v", b.Files, want)
+	}
+
+	if want := []string{filepath.Join(root, "broken") + ": no readable artifacts"}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped = %v, want %v", skipped, want)
+	}
+
+	artifacts, err := b.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(artifacts.Manifest) != artifactJson("b", "2024-05-02T10:00:00Z") ||
+		string(artifacts.RunResults) != artifactJson("b", "2024-05-02T10:05:00Z") ||
+		len(artifacts.Catalog) != 0 {
+		t.Errorf("Load() assembled the wrong artifacts")
+	}
+}
+
+func TestRun_Resumes(t *testing.T) {
+	root := archiveRoot(t)
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	var uploaded []string
+	failing := map[string]bool{"b": true}
+	upload := func(ctx context.Context, invocation *Invocation, artifacts *dbt.Artifacts) error {
+		if failing[invocation.InvocationId] {
+			return errors.New("unavailable")
+		}
+		uploaded = append(uploaded, artifacts.InvocationId)
+		return nil
+	}
+
+	summary, err := Run(context.Background(), Options{Root: root, StateFile: stateFile}, upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "c"}; !reflect.DeepEqual(summary.Uploaded, want) {
+		t.Errorf("Uploaded = %v, want %v", summary.Uploaded, want)
+	}
+	if summary.Failed["b"] != "unavailable" {
+		t.Errorf("Failed = %v", summary.Failed)
+	}
+
+	// A second run only retries what failed.
+	uploaded, failing = nil, nil
+	summary, err = Run(context.Background(), Options{Root: root, StateFile: stateFile}, upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b"}; !reflect.DeepEqual(uploaded, want) {
+		t.Errorf("uploaded = %v, want %v", uploaded, want)
+	}
+	if want := []string{"a", "c"}; !reflect.DeepEqual(summary.AlreadyUploaded, want) {
+		t.Errorf("AlreadyUploaded = %v, want %v", summary.AlreadyUploaded, want)
+	}
+}
+
+func TestRun_DryRun(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	upload := func(ctx context.Context, invocation *Invocation, artifacts *dbt.Artifacts) error {
+		t.Errorf("dry run must not upload %s", invocation.InvocationId)
+		return nil
+	}
+	if _, err := Run(context.Background(), Options{Root: archiveRoot(t), StateFile: stateFile, DryRun: true}, upload); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Errorf("dry run must not write the state file, got %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package backfill
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getsynq/synq-dbt/dbt"
+	"github.com/getsynq/synq-dbt/source"
+	"github.com/sirupsen/logrus"
+)
+
+// artifactNames are the files that make a directory an artifact set.
+var artifactNames = []string{"manifest.json", "run_results.json", "catalog.json", "sources.json"}
+
+// skippedDirs are never searched for artifact sets.
+var skippedDirs = map[string]bool{
+	"node_modules": true,
+	"dbt_packages": true,
+	"dbt_modules":  true,
+	"venv":         true,
+}
+
+// Discover walks root and returns every artifact set below it: directories
+// holding at least one dbt artifact, and .tar.gz/.tgz/.zip archives, which
+// are opened later with source.Open. Directories of an artifact set are not
+// searched further, a target directory's compiled/ and run/ trees can be
+// large.
+func Discover(root string) ([]string, error) {
+	var locations []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			logrus.Warnf("synq-dbt backfill can't read %s, skipping: %s", path, err)
+			return nil
+		}
+
+		if !entry.IsDir() {
+			if isArchive(path) {
+				locations = append(locations, path)
+			}
+			return nil
+		}
+
+		name := entry.Name()
+		if path != root && (strings.HasPrefix(name, ".") || skippedDirs[name]) {
+			return filepath.SkipDir
+		}
+		if hasArtifact(path) {
+			locations = append(locations, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return locations, err
+}
+
+func isArchive(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz") || strings.HasSuffix(lower, ".zip")
+}
+
+func hasArtifact(dir string) bool {
+	for _, name := range artifactNames {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.Mode().IsRegular() {
+			return true
+		}
+	}
+	return false
+}
+
+// Invocation is one dbt invocation found by Index, possibly assembled from
+// artifacts of several artifact sets.
+type Invocation struct {
+	InvocationId string
+	// GeneratedAt is the latest generated_at among the invocation's
+	// artifacts.
+	GeneratedAt time.Time
+	// Files maps each artifact name to the artifact set it is read from.
+	Files map[string]string
+
+	generatedAt map[string]time.Time
+}
+
+// Locations returns the artifact sets the invocation is read from.
+func (i *Invocation) Locations() []string {
+	seen := map[string]bool{}
+	var locations []string
+	for _, location := range i.Files {
+		if !seen[location] {
+			seen[location] = true
+			locations = append(locations, location)
+		}
+	}
+	sort.Strings(locations)
+	return locations
+}
+
+// Load reads the invocation's artifacts back from their artifact sets.
+func (i *Invocation) Load(ctx context.Context) (*dbt.Artifacts, error) {
+	artifacts := &dbt.Artifacts{InvocationId: i.InvocationId, Metadata: map[string]dbt.ArtifactMetadata{}}
+	for _, location := range i.Locations() {
+		src, err := source.Open(ctx, location)
+		if err != nil {
+			return nil, err
+		}
+		collected := dbt.CollectDbtArtifactsFS(src, src.Location)
+		for name, from := range i.Files {
+			if from == location {
+				dbt.CopyArtifact(artifacts, collected, name)
+			}
+		}
+		_ = src.Close()
+	}
+	return artifacts, nil
+}
+
+// Index reads every artifact set and groups the artifacts by invocation_id,
+// oldest invocation first. Artifact content is not kept, Load reads it again
+// when the invocation is uploaded. When the same artifact of an invocation
+// appears in several sets, e.g. copies of one run archived twice, the most
+// recently generated one wins. Artifact sets that can't be read and
+// artifacts without an invocation_id are reported as skipped.
+func Index(ctx context.Context, locations []string) ([]*Invocation, []string) {
+	invocations := map[string]*Invocation{}
+	var skipped []string
+
+	for _, location := range locations {
+		src, err := source.Open(ctx, location)
+		if err != nil {
+			skipped = append(skipped, location+": "+err.Error())
+			continue
+		}
+		collected := dbt.CollectDbtArtifactsFS(src, src.Location)
+		_ = src.Close()
+
+		if len(collected.Metadata) == 0 {
+			skipped = append(skipped, location+": no readable artifacts")
+		}
+		for name, metadata := range collected.Metadata {
+			if metadata.InvocationId == "" {
+				skipped = append(skipped, filepath.Join(location, name)+": no invocation_id")
+				continue
+			}
+			invocation, ok := invocations[metadata.InvocationId]
+			if !ok {
+				invocation = &Invocation{
+					InvocationId: metadata.InvocationId,
+					Files:        map[string]string{},
+					generatedAt:  map[string]time.Time{},
+				}
+				invocations[metadata.InvocationId] = invocation
+			}
+
+			generatedAt := metadata.GeneratedAtTime()
+			if _, duplicate := invocation.Files[name]; duplicate && !generatedAt.After(invocation.generatedAt[name]) {
+				continue
+			}
+			invocation.Files[name] = location
+			invocation.generatedAt[name] = generatedAt
+			if generatedAt.After(invocation.GeneratedAt) {
+				invocation.GeneratedAt = generatedAt
+			}
+		}
+	}
+
+	result := make([]*Invocation, 0, len(invocations))
+	for _, invocation := range invocations {
+		result = append(result, invocation)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].GeneratedAt.Equal(result[j].GeneratedAt) {
+			return result[i].GeneratedAt.Before(result[j].GeneratedAt)
+		}
+		return result[i].InvocationId < result[j].InvocationId
+	})
+	sort.Strings(skipped)
+	return result, skipped
+}
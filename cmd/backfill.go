@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/getsynq/synq-dbt/backfill"
+	"github.com/getsynq/synq-dbt/build"
+	"github.com/getsynq/synq-dbt/dbt"
+	"github.com/getsynq/synq-dbt/synq"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var BackfillStateFileFlag string
+var BackfillIntervalFlag time.Duration
+var BackfillDryRunFlag bool
+
+var backfillCmd = &cobra.Command{
+	Use:   "synq_backfill <root>",
+	Short: "Uploads to SYNQ all dbt artifacts archived below a directory, oldest first",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token := os.Getenv("SYNQ_TOKEN")
+		if len(SynqApiTokenFlag) > 0 {
+			token = SynqApiTokenFlag
+		}
+		if token == "" && !BackfillDryRunFlag {
+			logrus.Errorf("synq-dbt failed: missing SYNQ_TOKEN variable")
+			os.Exit(1)
+		}
+
+		options := backfill.Options{
+			Root:      args[0],
+			StateFile: BackfillStateFileFlag,
+			Interval:  BackfillIntervalFlag,
+			DryRun:    BackfillDryRunFlag,
+		}
+		tags := synq.Tags(TagFlags)
+		upload := func(ctx context.Context, invocation *backfill.Invocation, artifacts *dbt.Artifacts) error {
+			locations := strings.Join(invocation.Locations(), ",")
+			request := synq.NewRequestBuilder().
+				WithArtifacts(artifacts).
+				WithUploaderInfo(build.Version, build.Time).
+				WithTags(tags).
+				WithInvocationKind(synq.InvocationKindBackfill).
+				WithMetadata(synq.MetadataBackfill, locations).
+				Build()
+			return synq.UploadArtifacts(ctx, request, token, locations)
+		}
+
+		summary, err := backfill.Run(cmd.Context(), options, upload)
+		if summary != nil {
+			summary.Log()
+		}
+		if err != nil {
+			logrus.Errorf("synq-dbt backfill failed: %s", err.Error())
+			os.Exit(1)
+		}
+		if len(summary.Failed) > 0 {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	},
+}
+
+func init() {
+	backfillCmd.Flags().StringVar(&SynqApiTokenFlag, "synq-token", "", "SYNQ API token")
+	backfillCmd.Flags().StringVar(&BackfillStateFileFlag, "state-file", "synq-backfill-state.json", "File recording uploaded invocations, to resume an interrupted backfill (empty to disable)")
+	backfillCmd.Flags().DurationVar(&BackfillIntervalFlag, "interval", 2*time.Second, "Minimum time between two uploads")
+	backfillCmd.Flags().StringArrayVar(&TagFlags, "synq-tag", nil, "Tag key=value to attach to every uploaded invocation, can be repeated")
+	backfillCmd.Flags().BoolVar(&BackfillDryRunFlag, "dry-run", false, "List the invocations that would be uploaded without uploading them")
+}
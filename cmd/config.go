@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/getsynq/synq-dbt/command"
+	"github.com/getsynq/synq-dbt/config"
+	"github.com/getsynq/synq-dbt/dbt"
+	"github.com/getsynq/synq-dbt/logging"
+	"github.com/getsynq/synq-dbt/synq"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var ConfigProfileFlag string
+var ConfigProjectDirFlag string
+
+var configCmd = &cobra.Command{
+	Use:   "synq_config",
+	Short: "Prints the effective configuration of synq-dbt and where each value comes from",
+	Long: `Prints the effective configuration of synq-dbt and where each value comes from.
+
+Values are resolved, from highest to lowest precedence, from the environment,
+the selected profile of synq-dbt.yml, the top level of synq-dbt.yml and the
+built-in defaults. synq-dbt.yml is looked up from the dbt project directory:
+--project-dir, DBT_PROJECT_DIR or the current directory, as for a run.
+Command-line flags override all of them: --synq-target-dir
+or --synq-timeout of a wrapped dbt run, and --synq-token of the synq_*
+commands (run mode has no token flag).`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profile := os.Getenv(config.ProfileEnv)
+		if ConfigProfileFlag != "" {
+			profile = ConfigProfileFlag
+		}
+
+		projectDir := dbt.ResolveProjectDir(nil)
+		if ConfigProjectDirFlag != "" {
+			projectDir = ConfigProjectDirFlag
+		}
+
+		path := config.Find(projectDir)
+		var file *config.File
+		if path != "" {
+			var err error
+			if file, err = config.Load(path); err != nil {
+				return err
+			}
+		}
+		values, err := config.Resolve(file, profile)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if file == nil {
+			fmt.Fprintln(out, "config file: none")
+		} else {
+			fmt.Fprintf(out, "config file: %s\n", file.Path)
+		}
+		if profile == "" {
+			fmt.Fprintln(out, "profile:     none")
+		} else {
+			fmt.Fprintf(out, "profile:     %s\n", profile)
+		}
+		fmt.Fprintln(out)
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SETTING\tVARIABLE\tVALUE\tSOURCE")
+		for _, value := range values {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", value.Key, value.Env, value.Display(), value.Source)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	configCmd.Flags().StringVar(&ConfigProfileFlag, "profile", "", "Profile of synq-dbt.yml to use, overrides SYNQ_PROFILE")
+	configCmd.Flags().StringVar(&ConfigProjectDirFlag, "project-dir", "", "dbt project directory to look up synq-dbt.yml from, as passed to dbt, overrides DBT_PROJECT_DIR")
+}
+
+// applyConfig loads synq-dbt.yml for the project in projectDir, if there is
+// one, and exports its values to the environment variables which are still
+// unset. Problems with the file are logged and otherwise ignored, synq-dbt
+// must run dbt regardless.
+func applyConfig(projectDir string) {
+	path := config.Find(projectDir)
+	if path == "" {
+		return
+	}
+	file, err := config.Load(path)
+	if err != nil {
+		logrus.Warnf("synq-dbt ignoring configuration file: %s", err.Error())
+		return
+	}
+	values, err := config.Resolve(file, os.Getenv(config.ProfileEnv))
+	if err != nil {
+		logrus.Warnf("synq-dbt ignoring configuration file: %s", err.Error())
+		return
+	}
+	if err := config.Apply(values); err != nil {
+		logrus.Warnf("synq-dbt failed to apply configuration file %s: %s", path, err.Error())
+	}
+	logrus.Debugf("synq-dbt loaded configuration file %s", path)
+
+	// Some settings are read once at startup, read them again.
+	logging.ApplyEnv()
+	command.ApplyEnv()
+	synq.ApplyEnv()
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/getsynq/synq-dbt/env"
+	"github.com/getsynq/synq-dbt/git"
+	"github.com/getsynq/synq-dbt/synq"
+	"github.com/sirupsen/logrus"
+)
+
+// dbtCustomEnvPrefix marks variables dbt copies, without the prefix, into
+// metadata.env of every artifact it writes.
+const dbtCustomEnvPrefix = "DBT_ENV_CUSTOM_ENV_"
+
+// dbtRunContext returns what synq-dbt passes to dbt about the run: the run
+// id, the git commit and branch, whether the worktree had uncommitted
+// changes, and the normalized orchestrator context. dbt writes these into
+// every artifact, where they stay on disk, so none of the collected
+// environment variables are passed on.
+func dbtRunContext(runId string, gitContext *git.Context) map[string]string {
+	values := map[string]string{synq.RunIdEnv: runId}
+	if gitContext != nil {
+		if gitContext.CommitSha != "" {
+			values[git.ShaEnv] = gitContext.CommitSha
+		}
+		if gitContext.Branch != "" {
+			values[git.BranchEnv] = gitContext.Branch
+		}
+		if gitContext.Source == git.SourceGit {
+			values[git.DirtyKey] = strconv.FormatBool(gitContext.Dirty)
+		}
+	}
+	if runContext := env.DetectOrchestrator(); runContext != nil {
+		for key, value := range runContext.Metadata() {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// prepareDbtEnv collects the run context before dbt starts and returns the
+// variables dbt is started with, together with the git context of
+// projectDir for the upload to reuse. Like the upload it must never keep
+// dbt from running, so a panic only loses the context.
+func prepareDbtEnv(ctx context.Context, runId, projectDir string) (dbtEnv []string, gitContext *git.Context) {
+	dbtEnv = []string{synq.RunIdEnv + "=" + runId}
+	defer func() {
+		if r := recover(); r != nil {
+			logrus.Errorf("synq-dbt: panic while collecting the run context (ignored): %v", r)
+		}
+	}()
+
+	gitContext = git.Collect(ctx, projectDir)
+	dbtEnv = append(dbtEnv, dbtCustomEnv(dbtRunContext(runId, gitContext))...)
+	return dbtEnv, gitContext
+}
+
+// dbtCustomEnv turns values into DBT_ENV_CUSTOM_ENV_* entries for dbt's
+// environment, so the run context travels inside the artifacts and is still
+// there when they are uploaded later with synq_upload_artifacts. Variables
+// already set by the user are left alone.
+func dbtCustomEnv(values map[string]string) []string {
+	env := make([]string, 0, len(values))
+	for name, value := range values {
+		if _, set := os.LookupEnv(dbtCustomEnvPrefix + name); set {
+			continue
+		}
+		env = append(env, dbtCustomEnvPrefix+name+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	ingestdbtv1 "buf.build/gen/go/getsynq/api/protocolbuffers/go/synq/ingest/dbt/v1"
+	"github.com/getsynq/synq-dbt/build"
+	"github.com/getsynq/synq-dbt/command"
+	"github.com/getsynq/synq-dbt/dbt"
+	"github.com/getsynq/synq-dbt/git"
+	"github.com/getsynq/synq-dbt/synq"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var ParseTargetDirFlag string
+var ParseDryRunFlag bool
+
+// PreMergeUploadsEnv enables synq_parse uploads. They go to the same endpoint
+// as runs, so a workspace that doesn't support pre-merge invocations yet
+// would ingest them as production runs.
+const PreMergeUploadsEnv = "SYNQ_PRE_MERGE_UPLOADS"
+
+var parseCmd = &cobra.Command{
+	Use:   "synq_parse [-- dbt parse arguments]",
+	Short: "Runs dbt parse and uploads the manifest to SYNQ as a pre-merge invocation, needs SYNQ_PRE_MERGE_UPLOADS=true",
+	Long: `Runs "dbt parse" and uploads only the manifest to SYNQ, marked as a pre-merge,
+non-production invocation of the pull or merge request the CI job runs for.
+SYNQ uses it to show the impact of a change before it is merged.
+
+Arguments after "--" are passed to dbt parse, e.g.
+"synq-dbt synq_parse -- --target ci". With --target-dir an existing manifest is
+uploaded instead and dbt isn't run.
+
+The pull request's number, base and head commits and author are read from the
+CI environment, SYNQ_PR_NUMBER, SYNQ_PR_BASE_SHA, SYNQ_PR_HEAD_SHA and
+SYNQ_PR_AUTHOR override them.
+
+Pre-merge invocations are uploaded to the same endpoint as runs and only told
+apart by their SYNQ_INVOCATION_KIND. A SYNQ workspace without pre-merge
+support would take the manifest of the pull request for the production one,
+so uploads are refused unless SYNQ_PRE_MERGE_UPLOADS=true confirms that the
+workspace supports them. Without it the command exits with 1 before running
+dbt. --dry-run works without it.
+
+The ingest API has no request field or endpoint for pre-merge invocations
+yet; until it does, this command depends on server-side support for the
+SYNQ_INVOCATION_KIND marker.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		token := os.Getenv("SYNQ_TOKEN")
+		if len(SynqApiTokenFlag) > 0 {
+			token = SynqApiTokenFlag
+		}
+		if token == "" && !ParseDryRunFlag {
+			logrus.Errorf("synq-dbt failed: missing SYNQ_TOKEN variable")
+			os.Exit(1)
+		}
+		if err := checkPreMergeUploads(); err != nil && !ParseDryRunFlag {
+			logrus.Errorf("synq-dbt failed: %s", err.Error())
+			os.Exit(1)
+		}
+
+		dbtArgs := append([]string{"parse"}, args...)
+		projectDir := dbt.ResolveProjectDir(dbtArgs)
+		targetDir := ParseTargetDirFlag
+		var runId string
+		if targetDir == "" {
+			runId = synq.RunId()
+			dbtEnv, _ := prepareDbtEnv(ctx, runId, projectDir)
+			logrus.Infof("synq-dbt processing `%s`", strings.Join(append([]string{dbtBinary()}, dbtArgs...), " "))
+			exitCode, _, _, err := command.ExecuteCommandWithEnv(ctx, dbtEnv, dbtBinary(), dbtArgs...)
+			if err != nil || exitCode != 0 {
+				logrus.Errorf("synq-dbt dbt parse failed with exit code %d, nothing uploaded", exitCode)
+				if exitCode <= 0 {
+					exitCode = 1
+				}
+				os.Exit(exitCode)
+			}
+			targetDir = dbt.ResolveTargetDir(dbtArgs)
+		}
+
+		request, err := preMergeRequest(ctx, targetDir, projectDir, runId, dbtArgs)
+		if err != nil {
+			logrus.Errorf("synq-dbt failed: %s", err.Error())
+			os.Exit(1)
+		}
+
+		if ParseDryRunFlag {
+			logrus.Infof("synq-dbt dry run, not uploading %s: %s", filepath.Join(targetDir, "manifest.json"), synq.DescribeRequest(request))
+			return
+		}
+		if err := synq.UploadArtifacts(ctx, request, token, targetDir); err != nil {
+			os.Exit(1)
+		}
+	},
+}
+
+// checkPreMergeUploads returns an error unless PreMergeUploadsEnv enables
+// pre-merge uploads.
+func checkPreMergeUploads() error {
+	value := strings.TrimSpace(os.Getenv(PreMergeUploadsEnv))
+	if enabled, err := strconv.ParseBool(value); err == nil && enabled {
+		return nil
+	}
+	return fmt.Errorf("pre-merge uploads are disabled, set %s=true once your SYNQ workspace supports them", PreMergeUploadsEnv)
+}
+
+// preMergeRequest builds the request of a pre-merge invocation holding only
+// the manifest in targetDir. Run results, catalog and sources lying around
+// there describe some earlier run, not the change.
+func preMergeRequest(ctx context.Context, targetDir, projectDir, runId string, dbtArgs []string) (*ingestdbtv1.IngestInvocationRequest, error) {
+	collected := dbt.CollectDbtArtifacts(targetDir)
+	artifacts := &dbt.Artifacts{Metadata: map[string]dbt.ArtifactMetadata{}}
+	if !dbt.CopyArtifact(artifacts, collected, "manifest.json") {
+		return nil, fmt.Errorf("no manifest.json in %s", targetDir)
+	}
+	if runId == "" {
+		runId = artifacts.Env(synq.RunIdEnv)
+	}
+
+	pr := git.DetectPullRequest(ctx, projectDir)
+	if pr == nil {
+		logrus.Warnf("synq-dbt found no pull or merge request in the CI environment, set %s to link the upload to one", git.PullRequestNumberEnv)
+	}
+
+	return synq.NewRequestBuilder().
+		WithArtifacts(artifacts).
+		WithEnvVars(collectEnvVars()).
+		WithRunId(runId).
+		WithInvocationKind(synq.InvocationKindPreMerge).
+		WithPullRequest(pr).
+		WithTags(synq.Tags(TagFlags)).
+		WithUploaderInfo(build.Version, build.Time).
+		WithGitContext(ctx, projectDir).
+		WithChangedFiles(synq.ListChangedFiles(ctx, projectDir), artifacts, git.MaxDiffSize).
+		WithArgs(dbtArgs).
+		Build(), nil
+}
+
+func init() {
+	parseCmd.Flags().StringVar(&SynqApiTokenFlag, "synq-token", "", "SYNQ API token")
+	parseCmd.Flags().StringVar(&ParseTargetDirFlag, "target-dir", "", "Upload the manifest.json already in this directory instead of running dbt parse")
+	parseCmd.Flags().StringArrayVar(&TagFlags, "synq-tag", nil, "Tag key=value to attach to the invocation, can be repeated")
+	parseCmd.Flags().BoolVar(&ParseDryRunFlag, "dry-run", false, "Log what would be uploaded without uploading it")
+}
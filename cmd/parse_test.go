@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getsynq/synq-dbt/git"
+	"github.com/getsynq/synq-dbt/synq"
+)
+
+func TestExecute_Parse(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	fakeDbt := filepath.Join(dir, "dbt")
+	script := "#!/bin/sh\n" +
+		"printf '%s ' \"$@\" > " + argsFile + "\n" +
+		"mkdir -p " + dir + "/target\n" +
+		"echo '{\"metadata\": {\"invocation_id\": \"parse-1\"}, \"nodes\": {}}' > " + dir + "/target/manifest.json\n"
+	if err := os.WriteFile(fakeDbt, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Results of an earlier run must not be uploaded with the manifest.
+	if err := os.MkdirAll(filepath.Join(dir, "target"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "target", "run_results.json"), []byte(`{"metadata": {"invocation_id": "old"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SYNQ_DBT_BIN", fakeDbt)
+	t.Setenv("SYNQ_TOKEN", "")
+	t.Setenv("SYNQ_PR_NUMBER", "42")
+	t.Cleanup(func() { ParseDryRunFlag = false })
+
+	out, code := executeRoot(t, "synq_parse", "--dry-run", "--", "--project-dir", dir)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, out)
+	}
+	got, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "parse --project-dir " + dir + " "; string(got) != want {
+		t.Errorf("dbt got %q, want %q", got, want)
+	}
+}
+
+func TestCheckPreMergeUploads(t *testing.T) {
+	for value, enabled := range map[string]bool{"": false, "false": false, "yes": false, "true": true, " 1 ": true} {
+		t.Setenv(PreMergeUploadsEnv, value)
+		if err := checkPreMergeUploads(); (err == nil) != enabled {
+			t.Errorf("%s=%q: checkPreMergeUploads() = %v", PreMergeUploadsEnv, value, err)
+		}
+	}
+}
+
+func TestPreMergeRequest(t *testing.T) {
+	targetDir := t.TempDir()
+	for name, content := range map[string]string{
+		"manifest.json":    `{"metadata": {"invocation_id": "parse-1", "env": {"SYNQ_RUN_ID": "run-1"}}, "nodes": {}}`,
+		"run_results.json": `{"metadata": {"invocation_id": "old"}, "results": []}`,
+	} {
+		if err := os.WriteFile(filepath.Join(targetDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("SYNQ_PR_NUMBER", "42")
+	t.Setenv("SYNQ_PR_AUTHOR", "ada")
+	t.Setenv("SYNQ_GIT_BASE_REF", "")
+
+	request, err := preMergeRequest(context.Background(), targetDir, t.TempDir(), "", []string{"parse"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(request.GetArtifacts()) != 1 || request.GetArtifacts()[0].GetManifestJson() == nil {
+		t.Errorf("expected only the manifest, got %d artifacts", len(request.GetArtifacts()))
+	}
+	env := request.GetEnvironmentVars()
+	for key, want := range map[string]string{
+		synq.MetadataInvocationKind: synq.InvocationKindPreMerge,
+		synq.MetadataProduction:     "false",
+		synq.MetadataRunId:          "run-1",
+		git.PullRequestNumberKey:    "42",
+		git.PullRequestAuthorKey:    "ada",
+	} {
+		if env[key] != want {
+			t.Errorf("%s = %q, want %q", key, env[key], want)
+		}
+	}
+
+	if _, err := preMergeRequest(context.Background(), t.TempDir(), t.TempDir(), "", nil); err == nil {
+		t.Errorf("expected an error without a manifest")
+	}
+}
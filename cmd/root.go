@@ -2,13 +2,108 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"strings"
+
+	"github.com/getsynq/synq-dbt/build"
+	"github.com/getsynq/synq-dbt/dbt"
+	"github.com/spf13/cobra"
 )
 
-func Execute(ctx context.Context) {
-	if len(os.Args) > 1 && os.Args[1] == "synq_upload_artifacts" {
-		_ = uploadRunCmd.ExecuteContext(ctx)
-	} else {
-		_ = runCmd.ExecuteContext(ctx)
+// wrapperCommandPrefix marks synq-dbt's own commands. Everything else,
+// including --help, --version, help and completion, belongs to dbt.
+const wrapperCommandPrefix = "synq_"
+
+var rootCmd = &cobra.Command{
+	Use:   "synq-dbt",
+	Short: "Runs dbt and uploads its artifacts to SYNQ",
+	Long: `synq-dbt wraps dbt: any command that isn't one of the synq_* commands below
+is passed to dbt unchanged, e.g. "synq-dbt run --select finance" runs
+"dbt run --select finance" and uploads the artifacts to SYNQ afterwards.
+
+Arguments starting with --synq- are read by synq-dbt and not passed to dbt.`,
+	SilenceUsage: true,
+	CompletionOptions: cobra.CompletionOptions{
+		DisableDefaultCmd: true,
+	},
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "synq_version",
+	Short: "Prints the version of synq-dbt",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Fprintf(cmd.OutOrStdout(), "synq-dbt %s (%s)\n", strings.TrimSpace(build.Version), strings.TrimSpace(build.Time))
+	},
+}
+
+var completionCmd = &cobra.Command{
+	Use:       "synq_completion [bash|zsh|fish|powershell]",
+	Short:     "Generates the shell completion script for synq-dbt's own commands",
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+		switch args[0] {
+		case "bash":
+			return rootCmd.GenBashCompletionV2(out, true)
+		case "zsh":
+			return rootCmd.GenZshCompletion(out)
+		case "fish":
+			return rootCmd.GenFishCompletion(out, true)
+		case "powershell":
+			return rootCmd.GenPowerShellCompletionWithDesc(out)
+		}
+		return fmt.Errorf("unsupported shell %q", args[0])
+	},
+}
+
+var helpCmd = &cobra.Command{
+	Use:   "synq_help [command]",
+	Short: "Help about synq-dbt's own commands",
+	Run: func(cmd *cobra.Command, args []string) {
+		target, _, err := rootCmd.Find(args)
+		if target == nil || err != nil {
+			target = rootCmd
+		}
+		target.SetOut(cmd.OutOrStdout())
+		_ = target.Help()
+	},
+}
+
+func init() {
+	rootCmd.SetHelpCommand(helpCmd)
+	rootCmd.AddCommand(uploadRunCmd, parseCmd, backfillCmd, configCmd, versionCmd, completionCmd)
+}
+
+// isWrapperInvocation reports whether args are meant for synq-dbt itself
+// rather than for dbt: a synq_* command, or cobra's hidden completion
+// requests issued by the completion scripts.
+func isWrapperInvocation(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	return strings.HasPrefix(args[0], wrapperCommandPrefix) || strings.HasPrefix(args[0], cobra.ShellCompRequestCmd)
+}
+
+// execute runs args and returns the exit code.
+func execute(ctx context.Context, args []string) int {
+	if !isWrapperInvocation(args) {
+		applyConfig(dbt.ResolveProjectDir(args))
+		return runDbt(ctx, args)
+	}
+	if len(args) == 0 || args[0] != configCmd.Name() {
+		applyConfig(dbt.ResolveProjectDir(nil))
 	}
+
+	rootCmd.SetArgs(args)
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		return 1
+	}
+	return 0
+}
+
+func Execute(ctx context.Context) {
+	os.Exit(execute(ctx, os.Args[1:]))
 }
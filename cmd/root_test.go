@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getsynq/synq-dbt/build"
+)
+
+func TestIsWrapperInvocation(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{nil, false},
+		{[]string{"run", "--select", "finance"}, false},
+		{[]string{"--version"}, false},
+		{[]string{"--help"}, false},
+		{[]string{"help"}, false},
+		{[]string{"completion"}, false},
+		{[]string{"debug", "--config-dir"}, false},
+		{[]string{"--synq-dry-run", "run"}, false},
+		{[]string{"synq_upload_artifacts", "--from", "target.zip"}, true},
+		{[]string{"synq_backfill", "archive"}, true},
+		{[]string{"synq_version"}, true},
+		{[]string{"synq_help"}, true},
+		{[]string{"synq_unknown"}, true},
+		{[]string{"__complete", "synq_"}, true},
+	}
+	for _, tt := range tests {
+		if got := isWrapperInvocation(tt.args); got != tt.want {
+			t.Errorf("isWrapperInvocation(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func executeRoot(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(&out)
+	t.Cleanup(func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+	})
+	code := execute(context.Background(), args)
+	return out.String(), code
+}
+
+func TestExecute_Version(t *testing.T) {
+	out, code := executeRoot(t, "synq_version")
+	if code != 0 || !strings.Contains(out, "synq-dbt "+strings.TrimSpace(build.Version)) {
+		t.Errorf("synq_version printed %q, exit code %d", out, code)
+	}
+}
+
+func TestExecute_Help(t *testing.T) {
+	out, code := executeRoot(t, "synq_help")
+	if code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+	for _, command := range []string{"synq_upload_artifacts", "synq_parse", "synq_backfill", "synq_version", "synq_completion"} {
+		if !strings.Contains(out, command) {
+			t.Errorf("help does not list %s:\n%s", command, out)
+		}
+	}
+
+	out, _ = executeRoot(t, "synq_help", "synq_backfill")
+	if !strings.Contains(out, "--state-file") {
+		t.Errorf("synq_help synq_backfill should show its flags:\n%s", out)
+	}
+}
+
+func TestExecute_UnknownWrapperCommand(t *testing.T) {
+	if _, code := executeRoot(t, "synq_unknown"); code == 0 {
+		t.Error("unknown synq_* commands must fail instead of reaching dbt")
+	}
+}
+
+// TestExecute_PassThrough pins that everything but synq_* commands reaches
+// dbt unchanged, apart from the wrapper's --synq-* flags, and that dbt's
+// exit code is returned.
+func TestExecute_PassThrough(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	fakeDbt := filepath.Join(dir, "dbt")
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + argsFile + "\nexit 3\n"
+	if err := os.WriteFile(fakeDbt, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SYNQ_DBT_BIN", fakeDbt)
+	t.Setenv("SYNQ_TOKEN", "")
+
+	for _, args := range [][]string{
+		{"--version"},
+		{"--help"},
+		{"help"},
+		{"run", "--select", "tag:nightly finance", "--synq-no-upload", "--target", "prod"},
+	} {
+		code := execute(context.Background(), args)
+		if code != 3 {
+			t.Errorf("%q: exit code %d, want dbt's 3", args, code)
+		}
+		got, err := os.ReadFile(argsFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dbtArgs, _ := parseWrapperFlags(args)
+		if want := strings.Join(dbtArgs, "\n") + "\n"; string(got) != want {
+			t.Errorf("%q: dbt got %q, want %q", args, got, want)
+		}
+	}
+}
+
+func TestExecute_ConfigProjectDir(t *testing.T) {
+	project := t.TempDir()
+	if err := os.WriteFile(filepath.Join(project, "synq-dbt.yml"), []byte("dbt_bin: /opt/dbt/bin/dbt\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The test runs in cmd/, which holds no synq-dbt.yml.
+	t.Setenv("SYNQ_CONFIG", "")
+	t.Setenv("DBT_PROJECT_DIR", "")
+	t.Setenv("SYNQ_DBT_BIN", "")
+	os.Unsetenv("SYNQ_DBT_BIN")
+	t.Cleanup(func() { ConfigProjectDirFlag = "" })
+
+	out, code := executeRoot(t, "synq_config", "--project-dir", project)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, out)
+	}
+	if !strings.Contains(out, filepath.Join(project, "synq-dbt.yml")) || !strings.Contains(out, "/opt/dbt/bin/dbt") {
+		t.Errorf("synq_config did not use the project's synq-dbt.yml:\n%s", out)
+	}
+}
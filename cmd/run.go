@@ -4,83 +4,169 @@ import (
 	"context"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/getsynq/synq-dbt/build"
 	"github.com/getsynq/synq-dbt/command"
 	"github.com/getsynq/synq-dbt/dbt"
+	"github.com/getsynq/synq-dbt/env"
+	"github.com/getsynq/synq-dbt/git"
+	"github.com/getsynq/synq-dbt/logging"
 	"github.com/getsynq/synq-dbt/synq"
 	"github.com/sirupsen/logrus"
-	"github.com/spf13/cobra"
 )
 
+// wrappedRun is what uploadArtifactsSafe needs to know about a finished
+// dbt run.
+type wrappedRun struct {
+	runId     string
+	flags     wrapperFlags
+	args      []string
+	startedAt time.Time
+	// gitContext was collected from projectDir before dbt started.
+	projectDir string
+	gitContext *git.Context
+	exitCode   int
+	stdOut     []byte
+	stdErr     []byte
+	watch      *dbt.RunResultsWatch
+}
+
 // uploadArtifactsSafe runs the SYNQ-side upload pipeline with a panic guard
 // so that any failure on our side (artifact parsing, gRPC, OAuth, …) is
 // swallowed and never affects dbt's exit code propagation. The wrapper is
 // supposed to be transparent: dbt has already finished by the time we get
 // here, and the orchestrator must see dbt's real exit code.
-func uploadArtifactsSafe(
-	ctx context.Context,
-	token string,
-	args []string,
-	exitCode int,
-	stdOut, stdErr []byte,
-) {
+func uploadArtifactsSafe(ctx context.Context, token string, run *wrappedRun) {
 	defer func() {
 		if r := recover(); r != nil {
 			logrus.Errorf("synq-dbt: panic during upload (ignored): %v", r)
 		}
 	}()
 
-	targetDirectory := dbt.ResolveTargetDir(args)
-	artifacts := dbt.CollectDbtArtifacts(targetDirectory)
-
-	request := synq.NewRequestBuilder().
-		WithArtifacts(artifacts).
-		WithStdOut(stdOut).
-		WithStdErr(stdErr).
-		WithEnvVars(collectEnvVars()).
-		WithUploaderInfo(build.Version, build.Time).
-		WithArgs(args).
-		WithExitCode(exitCode).
-		WithGitContext(ctx, ".").
-		Build()
-
-	synq.UploadArtifacts(ctx, request, token, targetDirectory)
-}
+	if run.flags.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, run.flags.Timeout)
+		defer cancel()
+	}
 
-// runCmd represents the run command
-var runCmd = &cobra.Command{
-	FParseErrWhitelist: cobra.FParseErrWhitelist{UnknownFlags: true},
-	SilenceUsage:       true,
-	Run: func(cmd *cobra.Command, args []string) {
-		// Load configuration
-		token, ok := os.LookupEnv("SYNQ_TOKEN")
-		if !ok || token == "" {
-			logrus.Warnf("synq-dbt failed: missing SYNQ_TOKEN variable")
+	// Every project is uploaded as its own invocation. The captured output
+	// is shared by all of them, so it is only used to rebuild missing
+	// run_results when there is a single project it can belong to.
+	projects := dbt.ResolveProjects(run.args, run.watch, run.startedAt)
+	if run.flags.TargetDir != "" {
+		projects = []dbt.Project{{Dir: dbt.ResolveProjectDir(run.args), TargetDir: run.flags.TargetDir}}
+	}
+	tags := synq.Tags(run.flags.Tags)
+	policy := dbt.InvocationIdPolicyFromEnv()
+	envVars := collectEnvVars()
+	for _, project := range projects {
+		gitContext := run.gitContext
+		if project.Dir != run.projectDir {
+			gitContext = git.Collect(ctx, project.Dir)
 		}
+		changedFiles := synq.ListChangedFiles(ctx, project.Dir)
 
-		dbtBin, ok := os.LookupEnv("SYNQ_DBT_BIN")
-		dbtBin = strings.TrimSpace(dbtBin)
-		if !ok || dbtBin == "" {
-			dbtBin = "dbt"
+		artifacts := dbt.CollectDbtArtifacts(project.TargetDir)
+		if len(projects) == 1 {
+			dbt.SynthesizeRunResults(artifacts, run.stdOut, run.startedAt)
 		}
+		dbt.CollectExtraArtifacts(artifacts, project.TargetDir, dbt.ExtraArtifactOptionsFromEnv())
 
-		// Collect all arguments including flags
-		args = os.Args[1:]
+		for i, invocation := range dbt.ApplyInvocationIdPolicy(artifacts, policy) {
+			builder := synq.NewRequestBuilder().
+				WithArtifacts(invocation).
+				WithEnvVars(envVars).
+				WithRunId(run.runId).
+				WithInvocationKind(synq.InvocationKindRun).
+				WithTags(tags).
+				WithUploaderInfo(build.Version, build.Time).
+				WithCollectedGitContext(gitContext).
+				WithChangedFiles(changedFiles, invocation, git.MaxDiffSize)
 
-		logrus.Infof("synq-dbt processing `%s`", strings.Join(append([]string{dbtBin}, args...), " "))
+			// Output, args and exit code describe this run only, not
+			// artifacts split off from earlier invocations.
+			if i == 0 {
+				builder.
+					WithStdOut(run.stdOut).
+					WithStdErr(run.stdErr).
+					WithArgs(run.args).
+					WithExitCode(run.exitCode)
+			}
 
-		exitCode, stdOut, stdErr, err := command.ExecuteCommand(cmd.Context(), dbtBin, args...)
-		if err != nil {
-			logrus.Warnf("synq-dbt execution of dbt finished with exit code %d, %s", exitCode, err.Error())
+			if run.flags.DryRun {
+				logrus.Infof("synq-dbt dry run, not uploading %s: %s", project.TargetDir, synq.DescribeRequest(builder.Build()))
+				continue
+			}
+			synq.UploadArtifacts(ctx, builder.Build(), token, project.TargetDir)
 		}
+	}
+}
 
-		if token != "" {
-			uploadArtifactsSafe(cmd.Context(), token, args, exitCode, stdOut, stdErr)
-		}
+// runDbt is the pass-through mode: it runs dbt with args, minus the
+// wrapper's own --synq-* flags, uploads the outcome to SYNQ and returns dbt's
+// exit code for synq-dbt to exit with.
+func runDbt(ctx context.Context, args []string) int {
+	// Load configuration
+	token, ok := os.LookupEnv("SYNQ_TOKEN")
+	if !ok || token == "" {
+		logrus.Warnf("synq-dbt failed: missing SYNQ_TOKEN variable")
+	}
+
+	dbtBin := dbtBinary()
+
+	// Collect all arguments including flags, except the wrapper's own
+	args, flags := parseWrapperFlags(args)
+	if flags.Quiet {
+		logging.SetQuiet()
+	}
+
+	logrus.Infof("synq-dbt processing `%s`", strings.Join(append([]string{dbtBin}, args...), " "))
+
+	// The run id ties the upload to the orchestrator task even when dbt
+	// fails before it writes any artifact. It travels to dbt together
+	// with the rest of the run context, so artifacts which are written
+	// carry it in metadata.env.
+	runId := synq.RunId()
+	logrus.Infof("synq-dbt run id `%s`", runId)
+	projectDir := dbt.ResolveProjectDir(args)
+	dbtEnv, gitContext := prepareDbtEnv(ctx, runId, projectDir)
 
-		os.Exit(exitCode)
-	},
+	watch := dbt.WatchRunResults()
+
+	startedAt := time.Now()
+	exitCode, stdOut, stdErr, err := command.ExecuteCommandWithEnv(ctx, dbtEnv, dbtBin, args...)
+	if err != nil {
+		logrus.Warnf("synq-dbt execution of dbt finished with exit code %d, %s", exitCode, err.Error())
+	}
+
+	switch {
+	case flags.NoUpload:
+		logrus.Infof("synq-dbt upload disabled by --synq-no-upload")
+	case token != "" || flags.DryRun:
+		uploadArtifactsSafe(ctx, token, &wrappedRun{
+			runId:      runId,
+			flags:      flags,
+			args:       args,
+			startedAt:  startedAt,
+			projectDir: projectDir,
+			gitContext: gitContext,
+			exitCode:   exitCode,
+			stdOut:     stdOut,
+			stdErr:     stdErr,
+			watch:      watch,
+		})
+	}
+
+	return exitCode
+}
+
+// dbtBinary returns the dbt binary to run, SYNQ_DBT_BIN or "dbt".
+func dbtBinary() string {
+	if dbtBin := strings.TrimSpace(os.Getenv("SYNQ_DBT_BIN")); dbtBin != "" {
+		return dbtBin
+	}
+	return "dbt"
 }
 
 var EnvsToCollect = map[string]struct{}{
@@ -92,12 +178,32 @@ var EnvsToCollect = map[string]struct{}{
 	"AIRFLOW_CTX_DAG_RUN_ID":     {},
 }
 
+// collectEnvVars collects EnvsToCollect plus whatever SYNQ_ENV_ALLOW adds,
+// see env.OptionsFromEnv. When the orchestrator is recognised, its own
+// variables are collected too, together with the normalized run context
+// under SYNQ_ORCHESTRATOR* keys. Inside Kubernetes the pod is described
+// under SYNQ_K8S_* keys.
 func collectEnvVars() map[string]string {
-	envs := map[string]string{}
+	allow := make([]string, 0, len(EnvsToCollect))
 	for envName := range EnvsToCollect {
-		envValue := os.Getenv(envName)
-		if len(envValue) > 0 {
-			envs[envName] = envValue
+		allow = append(allow, envName)
+	}
+
+	runContext := env.DetectOrchestrator()
+	if runContext != nil {
+		allow = append(allow, runContext.Env...)
+	}
+
+	options := env.OptionsFromEnv(allow)
+	envs := env.Collect(os.Environ(), options)
+	if runContext != nil {
+		for key, value := range runContext.Metadata() {
+			envs[key] = value
+		}
+	}
+	if pod := env.DetectKubernetes(); pod != nil {
+		for key, value := range pod.Metadata(options.MaxValueSize) {
+			envs[key] = value
 		}
 	}
 	return envs
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseWrapperFlags(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantArgs  []string
+		wantFlags wrapperFlags
+	}{
+		{
+			name:     "no wrapper flags",
+			args:     []string{"run", "--select", "finance", "--target-path", "out"},
+			wantArgs: []string{"run", "--select", "finance", "--target-path", "out"},
+		},
+		{
+			name: "all flags",
+			args: []string{
+				"--synq-dry-run", "build", "--synq-target-dir", "custom/target", "--select", "x",
+				"--synq-tag", "team=finance", "--synq-tag=env=prod", "--synq-no-upload=false", "--synq-timeout=90s",
+				"--synq-quiet",
+			},
+			wantArgs: []string{"build", "--select", "x"},
+			wantFlags: wrapperFlags{
+				DryRun:    true,
+				TargetDir: "custom/target",
+				Tags:      []string{"team=finance", "env=prod"},
+				Timeout:   90 * time.Second,
+				Quiet:     true,
+			},
+		},
+		{
+			name:      "invalid and unknown flags are dropped",
+			args:      []string{"run", "--synq-timeout", "soon", "--synq-colour", "--synq-no-upload", "--synq-tag"},
+			wantArgs:  []string{"run"},
+			wantFlags: wrapperFlags{NoUpload: true},
+		},
+		{
+			name:      "dbt flags are never taken as values",
+			args:      []string{"run", "--synq-tag", "--select", "x", "--synq-target-dir", "-s", "y", "--synq-tag=-neg=1"},
+			wantArgs:  []string{"run", "--select", "x", "-s", "y"},
+			wantFlags: wrapperFlags{Tags: []string{"-neg=1"}},
+		},
+		{
+			name:     "after --",
+			args:     []string{"run-operation", "macro", "--", "--synq-dry-run"},
+			wantArgs: []string{"run-operation", "macro", "--", "--synq-dry-run"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, flags := parseWrapperFlags(tt.args)
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %q, want %q", args, tt.wantArgs)
+			}
+			if !reflect.DeepEqual(flags, tt.wantFlags) {
+				t.Errorf("flags = %+v, want %+v", flags, tt.wantFlags)
+			}
+		})
+	}
+}
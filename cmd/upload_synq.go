@@ -1,10 +1,16 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/getsynq/synq-dbt/build"
 	"github.com/getsynq/synq-dbt/dbt"
+	"github.com/getsynq/synq-dbt/git"
+	"github.com/getsynq/synq-dbt/source"
 	"github.com/getsynq/synq-dbt/synq"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -12,6 +18,26 @@ import (
 
 var SynqApiTokenFlag string
 var DbtLogFile string
+var FromFlag string
+var ExitCodeFlag int
+var DbtArgsFlag string
+var StdErrFileFlag string
+var TargetDirFlag string
+var EnvFlags []string
+var GitDirFlag string
+var TagFlags []string
+
+// uploadedRun describes the dbt run the uploaded artifacts come from, as far
+// as it is known to the upload command.
+type uploadedRun struct {
+	args     []string
+	exitCode int
+	stdOut   []byte
+	stdErr   []byte
+	env      map[string]string
+	tags     map[string]string
+	gitDir   string
+}
 
 var uploadRunCmd = &cobra.Command{
 	Use:   "synq_upload_artifacts",
@@ -26,28 +52,200 @@ var uploadRunCmd = &cobra.Command{
 			logrus.Errorf("synq-dbt failed: missing SYNQ_TOKEN variable")
 			return
 		}
+		if len(FromFlag) > 0 && len(TargetDirFlag) > 0 {
+			logrus.Errorf("synq-dbt failed: --from and --target-dir can't be used together")
+			os.Exit(1)
+		}
+
+		run, err := uploadedRunFromFlags()
+		if err != nil {
+			logrus.Errorf("synq-dbt failed: %s", err.Error())
+			os.Exit(1)
+		}
+
+		switch {
+		case len(FromFlag) > 0:
+			src, err := source.Open(cmd.Context(), FromFlag)
+			if err != nil {
+				logrus.Errorf("synq-dbt failed: can't read artifacts from %s: %s", FromFlag, err.Error())
+				os.Exit(1)
+			}
+
+			// Git context comes from wherever the upload is run from.
+			artifacts := dbt.CollectDbtArtifactsFS(src, src.Location)
+			dbt.CollectExtraArtifactsFS(artifacts, src, dbt.ExtraArtifactOptionsFromEnv())
+			uploadInvocations(cmd.Context(), token, artifacts, dbt.ResolveProjectDir(run.args), src.Location, run)
+			_ = src.Close()
+		case len(TargetDirFlag) > 0:
+			projectDir := dbt.ResolveProjectDir(run.args)
+			artifacts := dbt.CollectDbtArtifacts(TargetDirFlag)
+			dbt.CollectExtraArtifacts(artifacts, TargetDirFlag, dbt.ExtraArtifactOptionsFromEnv())
+			uploadInvocations(cmd.Context(), token, artifacts, projectDir, TargetDirFlag, run)
+		default:
+			for _, project := range dbt.ResolveProjects(run.args, nil, time.Time{}) {
+				artifacts := dbt.CollectDbtArtifacts(project.TargetDir)
+				dbt.CollectExtraArtifacts(artifacts, project.TargetDir, dbt.ExtraArtifactOptionsFromEnv())
+				uploadInvocations(cmd.Context(), token, artifacts, project.Dir, project.TargetDir, run)
+			}
+		}
 
-		targetDirectory := dbt.ResolveTargetDir(nil)
-		artifacts := dbt.CollectDbtArtifacts(targetDirectory)
+		os.Exit(0)
+	},
+}
+
+func uploadedRunFromFlags() (*uploadedRun, error) {
+	run := &uploadedRun{exitCode: ExitCodeFlag, gitDir: GitDirFlag}
 
+	for _, tag := range TagFlags {
+		if _, _, err := synq.ParseTag(tag); err != nil {
+			return nil, err
+		}
+	}
+	run.tags = synq.Tags(TagFlags)
+
+	if len(DbtLogFile) > 0 {
+		stdOut, err := os.ReadFile(DbtLogFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read --dbt-log-file: %w", err)
+		}
+		run.stdOut = stdOut
+	}
+	if len(StdErrFileFlag) > 0 {
+		stdErr, err := os.ReadFile(StdErrFileFlag)
+		if err != nil {
+			return nil, fmt.Errorf("can't read --stderr-file: %w", err)
+		}
+		run.stdErr = stdErr
+	}
+
+	args, err := splitDbtArgs(DbtArgsFlag)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --dbt-args: %w", err)
+	}
+	run.args = args
+
+	env, err := parseEnvFlags(EnvFlags)
+	if err != nil {
+		return nil, err
+	}
+	run.env = env
+
+	return run, nil
+}
+
+// uploadInvocations uploads the collected artifacts as one or more
+// invocations, depending on the invocation_id policy. Output, args and exit
+// code describe the run itself, so only the first invocation carries them.
+func uploadInvocations(ctx context.Context, token string, artifacts *dbt.Artifacts, projectDir, location string, run *uploadedRun) {
+	gitDir := projectDir
+	if len(run.gitDir) > 0 {
+		gitDir = run.gitDir
+	}
+
+	// Artifacts of a wrapped run carry the wrapper's run id in metadata.env.
+	runId := artifacts.Env(synq.RunIdEnv)
+	if runId == "" {
+		runId = os.Getenv(synq.RunIdEnv)
+	}
+
+	changedFiles := synq.ListChangedFiles(ctx, gitDir)
+	for i, invocation := range dbt.ApplyInvocationIdPolicy(artifacts, dbt.InvocationIdPolicyFromEnv()) {
 		builder := synq.NewRequestBuilder().
-			WithArtifacts(artifacts).
+			WithArtifacts(invocation).
 			WithEnvVars(collectEnvVars()).
+			WithEnvVars(run.env).
+			WithRunId(runId).
+			WithInvocationKind(synq.InvocationKindRun).
+			WithTags(run.tags).
 			WithUploaderInfo(build.Version, build.Time).
-			WithGitContext(cmd.Context(), ".")
+			WithGitContext(ctx, gitDir).
+			WithChangedFiles(changedFiles, invocation, git.MaxDiffSize)
 
-		if len(DbtLogFile) > 0 {
-			stdOut, _ := os.ReadFile(DbtLogFile)
-			builder.WithStdOut(stdOut)
+		if i == 0 {
+			builder.
+				WithStdOut(run.stdOut).
+				WithStdErr(run.stdErr).
+				WithArgs(run.args).
+				WithExitCode(run.exitCode)
 		}
 
-		synq.UploadArtifacts(cmd.Context(), builder.Build(), token, targetDirectory)
+		synq.UploadArtifacts(ctx, builder.Build(), token, location)
+	}
+}
 
-		os.Exit(0)
-	},
+// splitDbtArgs splits the --dbt-args value the way a POSIX shell would split
+// words, honouring single and double quotes and backslash escapes. A leading
+// "dbt" is dropped so the value can be copied verbatim from a CI script.
+func splitDbtArgs(value string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range value {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", value)
+	}
+	if inWord {
+		args = append(args, current.String())
+	}
+
+	if len(args) > 0 && args[0] == "dbt" {
+		args = args[1:]
+	}
+	return args, nil
+}
+
+// parseEnvFlags turns repeated --env KEY=VAL flags into a map.
+func parseEnvFlags(values []string) (map[string]string, error) {
+	env := map[string]string{}
+	for _, value := range values {
+		key, val, ok := strings.Cut(value, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --env %q, expected KEY=VAL", value)
+		}
+		env[key] = val
+	}
+	return env, nil
 }
 
 func init() {
 	uploadRunCmd.Flags().StringVar(&SynqApiTokenFlag, "synq-token", "", "SYNQ API token")
 	uploadRunCmd.Flags().StringVar(&DbtLogFile, "dbt-log-file", "", "File with log output of dbt command")
+	uploadRunCmd.Flags().StringVar(&FromFlag, "from", "", "Target directory to upload: a directory, a .tar.gz/.tgz/.zip archive or an s3://bucket/prefix URL")
+	uploadRunCmd.Flags().IntVar(&ExitCodeFlag, "exit-code", 0, "Exit code of the dbt command")
+	uploadRunCmd.Flags().StringVar(&DbtArgsFlag, "dbt-args", "", "Arguments of the dbt command, e.g. \"build --select my_model\"")
+	uploadRunCmd.Flags().StringVar(&StdErrFileFlag, "stderr-file", "", "File with stderr output of dbt command")
+	uploadRunCmd.Flags().StringVar(&TargetDirFlag, "target-dir", "", "dbt target directory to read artifacts from")
+	uploadRunCmd.Flags().StringArrayVar(&EnvFlags, "env", nil, "Additional KEY=VAL environment entry to send, can be repeated")
+	uploadRunCmd.Flags().StringArrayVar(&TagFlags, "synq-tag", nil, "Tag key=value to attach to the invocation, can be repeated")
+	uploadRunCmd.Flags().StringVar(&GitDirFlag, "git-dir", "", "Directory to collect git context from (defaults to the dbt project directory)")
 }
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitDbtArgs(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{value: "", want: nil},
+		{value: "build --select my_model", want: []string{"build", "--select", "my_model"}},
+		{value: "dbt run  --vars '{\"a\": 1}'", want: []string{"run", "--vars", `{"a": 1}`}},
+		{value: `test --select "tag:nightly tag:daily"`, want: []string{"test", "--select", "tag:nightly tag:daily"}},
+		{value: `run --target prod\ eu ''`, want: []string{"run", "--target", "prod eu", ""}},
+		{value: `run --vars '{"a": 1}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := splitDbtArgs(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("splitDbtArgs(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitDbtArgs(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseEnvFlags(t *testing.T) {
+	got, err := parseEnvFlags([]string{"DAG_ID=nightly", "QUERY=a=b", "EMPTY="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"DAG_ID": "nightly", "QUERY": "a=b", "EMPTY": ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseEnvFlags() = %v, want %v", got, want)
+	}
+
+	for _, invalid := range []string{"NO_VALUE", "=value"} {
+		if _, err := parseEnvFlags([]string{invalid}); err == nil {
+			t.Errorf("parseEnvFlags(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestUploadedRunFromFlags_UnreadableFiles(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.log")
+	defer func() { DbtLogFile, StdErrFileFlag = "", "" }()
+
+	for name, flag := range map[string]*string{"--dbt-log-file": &DbtLogFile, "--stderr-file": &StdErrFileFlag} {
+		DbtLogFile, StdErrFileFlag = "", ""
+		*flag = missing
+		if _, err := uploadedRunFromFlags(); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s: expected an error naming the flag, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// wrapperFlagPrefix reserves a flag namespace for the wrapper in run mode.
+// dbt never sees these flags, and they are not part of the uploaded args.
+const wrapperFlagPrefix = "--synq-"
+
+// wrapperFlags are the --synq-* flags of a wrapped run.
+type wrapperFlags struct {
+	// DryRun collects artifacts and builds the requests but only logs them.
+	DryRun bool
+	// NoUpload skips everything SYNQ-related after dbt finished.
+	NoUpload bool
+	// TargetDir overrides where artifacts are read from, like
+	// SYNQ_TARGET_DIR but for this run only.
+	TargetDir string
+	// Tags are key=value tags, see synq.Tags.
+	Tags []string
+	// Quiet logs only the wrapper's warnings and errors, like SYNQ_QUIET.
+	Quiet bool
+	// Timeout bounds the whole upload, retries included. 0 means no bound.
+	Timeout time.Duration
+}
+
+// parseWrapperFlags splits the command line into the arguments meant for dbt
+// and the wrapper's own --synq-* flags. Values are taken from "--flag value"
+// or "--flag=value"; a following argument that starts with "-" is never a
+// value, so "--synq-tag --select x" can't swallow dbt's flag. Values that
+// start with "-" need the "=" form. Flags after a "--" argument are left to
+// dbt. Unknown or
+// invalid wrapper flags are logged and dropped, a typo must not turn into an
+// argument dbt chokes on.
+func parseWrapperFlags(args []string) (dbtArgs []string, flags wrapperFlags) {
+	dbtArgs = make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			dbtArgs = append(dbtArgs, args[i:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, wrapperFlagPrefix) {
+			dbtArgs = append(dbtArgs, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		// nextValue consumes the following argument as the flag's value.
+		nextValue := func() (string, bool) {
+			if hasValue {
+				return value, true
+			}
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+				return args[i], true
+			}
+			return "", false
+		}
+
+		var err error
+		switch name {
+		case "--synq-dry-run":
+			flags.DryRun, err = boolFlag(value, hasValue)
+		case "--synq-no-upload":
+			flags.NoUpload, err = boolFlag(value, hasValue)
+		case "--synq-quiet":
+			flags.Quiet, err = boolFlag(value, hasValue)
+		case "--synq-target-dir":
+			if dir, ok := nextValue(); ok && dir != "" {
+				flags.TargetDir = dir
+			} else {
+				err = fmt.Errorf("missing directory")
+			}
+		case "--synq-tag":
+			if tag, ok := nextValue(); ok {
+				flags.Tags = append(flags.Tags, tag)
+			} else {
+				err = fmt.Errorf("missing key=value")
+			}
+		case "--synq-timeout":
+			if duration, ok := nextValue(); ok {
+				flags.Timeout, err = time.ParseDuration(duration)
+			} else {
+				err = fmt.Errorf("missing duration")
+			}
+		default:
+			err = fmt.Errorf("unknown flag")
+		}
+		if err != nil {
+			logrus.Warnf("synq-dbt ignoring %s: %s", arg, err.Error())
+		}
+	}
+	return dbtArgs, flags
+}
+
+func boolFlag(value string, hasValue bool) (bool, error) {
+	if !hasValue {
+		return true, nil
+	}
+	return strconv.ParseBool(value)
+}
@@ -0,0 +1,110 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MaxCapturedOutput bounds how many bytes of dbt's stdout and of its stderr
+// are kept in memory for the upload. dbt runs of large projects print
+// hundreds of megabytes with debug logging, and the wrapper shares a pod
+// with dbt. When the limit is hit the beginning and the end of the output
+// are kept — the version banner and the first nodes at the start, the
+// errors and the run summary at the end — and the middle is dropped.
+// Nothing is ever dropped from what is mirrored to the terminal.
+//
+// Operators can override at startup via SYNQ_MAX_CAPTURED_OUTPUT (bytes).
+var MaxCapturedOutput = 64 << 20
+
+const maxCapturedOutputEnv = "SYNQ_MAX_CAPTURED_OUTPUT"
+
+func init() {
+	applyMaxCapturedOutputEnv()
+}
+
+func applyMaxCapturedOutputEnv() {
+	if v := os.Getenv(maxCapturedOutputEnv); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			MaxCapturedOutput = n
+		} else {
+			logrus.Warnf("ignoring %s=%q (must be a positive number of bytes)", maxCapturedOutputEnv, v)
+		}
+	}
+}
+
+// cappedBuffer is an io.Writer that keeps the first and the last limit/2
+// bytes written to it. Write never fails, so it is safe to combine with the
+// terminal in an io.MultiWriter.
+type cappedBuffer struct {
+	limit   int
+	head    []byte
+	tail    []byte // ring buffer, valid once tailLen > 0
+	tailPos int
+	tailLen int
+	dropped int64
+}
+
+func newCappedBuffer(limit int) *cappedBuffer {
+	return &cappedBuffer{limit: limit}
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+
+	if room := b.limit/2 - len(b.head); room > 0 {
+		take := min(room, len(p))
+		b.head = append(b.head, p[:take]...)
+		p = p[take:]
+	}
+	if len(p) == 0 {
+		return n, nil
+	}
+
+	tailLimit := b.limit - b.limit/2
+	if b.tail == nil {
+		b.tail = make([]byte, tailLimit)
+	}
+	if len(p) >= tailLimit {
+		b.dropped += int64(b.tailLen + len(p) - tailLimit)
+		copy(b.tail, p[len(p)-tailLimit:])
+		b.tailPos, b.tailLen = 0, tailLimit
+		return n, nil
+	}
+	for len(p) > 0 {
+		written := copy(b.tail[b.tailPos:], p)
+		p = p[written:]
+		b.tailPos = (b.tailPos + written) % tailLimit
+		if b.tailLen+written > tailLimit {
+			b.dropped += int64(b.tailLen + written - tailLimit)
+			b.tailLen = tailLimit
+		} else {
+			b.tailLen += written
+		}
+	}
+	return n, nil
+}
+
+// Bytes returns the captured output. When output was dropped, a marker line
+// stating how much is inserted between head and tail.
+func (b *cappedBuffer) Bytes() []byte {
+	if b.tailLen == 0 {
+		return b.head
+	}
+
+	var marker []byte
+	if b.dropped > 0 {
+		marker = []byte(fmt.Sprintf("\n[synq-dbt: %d bytes of output not captured]\n", b.dropped))
+	}
+
+	out := make([]byte, 0, len(b.head)+len(marker)+b.tailLen)
+	out = append(out, b.head...)
+	out = append(out, marker...)
+	if b.tailLen < len(b.tail) {
+		return append(out, b.tail[:b.tailLen]...)
+	}
+	out = append(out, b.tail[b.tailPos:]...)
+	return append(out, b.tail[:b.tailPos]...)
+}
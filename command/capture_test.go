@@ -0,0 +1,67 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCappedBuffer(t *testing.T) {
+	t.Run("under limit", func(t *testing.T) {
+		buf := newCappedBuffer(16)
+		buf.Write([]byte("hello "))
+		buf.Write([]byte("world"))
+		if got := string(buf.Bytes()); got != "hello world" {
+			t.Errorf("got %q", got)
+		}
+	})
+
+	t.Run("keeps head and tail", func(t *testing.T) {
+		buf := newCappedBuffer(8)
+		for _, chunk := range []string{"ab", "cdef", "ghij", "kl", "mnop"} {
+			if n, err := buf.Write([]byte(chunk)); n != len(chunk) || err != nil {
+				t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+			}
+		}
+		want := "abcd\n[synq-dbt: 8 bytes of output not captured]\nmnop"
+		if got := string(buf.Bytes()); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("single large write", func(t *testing.T) {
+		buf := newCappedBuffer(8)
+		buf.Write([]byte("0123456789abcdef"))
+		want := "0123\n[synq-dbt: 8 bytes of output not captured]\ncdef"
+		if got := string(buf.Bytes()); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("fills exactly", func(t *testing.T) {
+		buf := newCappedBuffer(8)
+		buf.Write([]byte("01234567"))
+		if got := string(buf.Bytes()); got != "01234567" {
+			t.Errorf("got %q", got)
+		}
+	})
+}
+
+func TestExecuteCommand_CapturedOutputLimit(t *testing.T) {
+	oldLimit := MaxCapturedOutput
+	MaxCapturedOutput = 1024
+	defer func() { MaxCapturedOutput = oldLimit }()
+
+	script := "echo FIRST; head -c 100000 /dev/zero | tr '\\0' 'a'; echo; echo LAST"
+	_, stdout, _, err := ExecuteCommand(context.Background(), "sh", "-c", script)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stdout) > 1024+100 {
+		t.Errorf("captured %d bytes, limit is 1024", len(stdout))
+	}
+	if !bytes.HasPrefix(stdout, []byte("FIRST\n")) || !strings.HasSuffix(string(stdout), "LAST\n") {
+		t.Errorf("head or tail of the output lost: %q...%q", stdout[:16], stdout[len(stdout)-16:])
+	}
+}
@@ -1,7 +1,6 @@
 package command
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -34,6 +33,17 @@ var CancelGracePeriod = 15 * time.Second
 const cancelGracePeriodEnv = "SYNQ_DBT_CANCEL_GRACE_PERIOD"
 
 func init() {
+	applyCancelGracePeriodEnv()
+}
+
+// ApplyEnv applies the SYNQ_* overrides of this package again, for variables
+// set after startup, e.g. from synq-dbt.yml.
+func ApplyEnv() {
+	applyCancelGracePeriodEnv()
+	applyMaxCapturedOutputEnv()
+}
+
+func applyCancelGracePeriodEnv() {
 	if v := os.Getenv(cancelGracePeriodEnv); v != "" {
 		if d, err := time.ParseDuration(v); err == nil && d > 0 {
 			CancelGracePeriod = d
@@ -53,8 +63,23 @@ func ExecuteCommand(
 	ctx context.Context,
 	cmdName string,
 	args ...string,
+) (exitCode int, stdOut []byte, stdErr []byte, err error) {
+	return ExecuteCommandWithEnv(ctx, nil, cmdName, args...)
+}
+
+// ExecuteCommandWithEnv is ExecuteCommand with extra KEY=VALUE entries added
+// to the environment the command inherits. Later entries win over earlier
+// ones and over the inherited environment.
+func ExecuteCommandWithEnv(
+	ctx context.Context,
+	env []string,
+	cmdName string,
+	args ...string,
 ) (exitCode int, stdOut []byte, stdErr []byte, err error) {
 	cmd := exec.CommandContext(ctx, cmdName, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 
 	// Pgid: 0 puts dbt in its own process group (PGID = dbt's PID) so we
 	// can deliver signals to the entire process tree, including grandchildren
@@ -86,13 +111,16 @@ func ExecuteCommand(
 	//     guaranteed to be gone after CancelGracePeriod.
 	cmd.Cancel = func() error {
 		pgid := -cmd.Process.Pid
-		logrus.Printf(
-			"cancelling subcommand pgid=%d (SIGINT, escalating to SIGKILL after %s)",
-			cmd.Process.Pid,
-			CancelGracePeriod,
-		)
+		logrus.WithFields(logrus.Fields{
+			"pgid":         cmd.Process.Pid,
+			"signal":       "SIGINT",
+			"grace_period": CancelGracePeriod.String(),
+		}).Info("cancelling subcommand, escalating to SIGKILL after the grace period")
 		killTimer = time.AfterFunc(CancelGracePeriod, func() {
-			logrus.Printf("subcommand pgid=%d still alive after grace period — SIGKILL", -pgid)
+			logrus.WithFields(logrus.Fields{
+				"pgid":   -pgid,
+				"signal": "SIGKILL",
+			}).Warn("subcommand still alive after grace period, killing it")
 			_ = syscall.Kill(pgid, syscall.SIGKILL)
 		})
 		if err := syscall.Kill(pgid, syscall.SIGINT); err != nil {
@@ -117,15 +145,20 @@ func ExecuteCommand(
 	// deadlock where a too-long line stops the scanner, the kernel pipe
 	// buffer fills, and dbt blocks mid-write unable to do any cleanup.
 	// cmd.Wait synchronises with the internal copy goroutines, so reading
-	// the buffers afterwards is race-free.
-	var stdoutBuf, stderrBuf bytes.Buffer
-	cmd.Stdout = io.MultiWriter(os.Stdout, &stdoutBuf)
-	cmd.Stderr = io.MultiWriter(os.Stderr, &stderrBuf)
+	// the buffers afterwards is race-free. The captured copies are bounded
+	// by MaxCapturedOutput, the terminal still sees everything.
+	stdoutBuf := newCappedBuffer(MaxCapturedOutput)
+	stderrBuf := newCappedBuffer(MaxCapturedOutput)
+	cmd.Stdout = io.MultiWriter(os.Stdout, stdoutBuf)
+	cmd.Stderr = io.MultiWriter(os.Stderr, stderrBuf)
 
 	if err := cmd.Start(); err != nil {
 		return -1, nil, nil, fmt.Errorf("starting %s: %w", cmdName, err)
 	}
-	logrus.Printf("subcommand pid=%d", cmd.Process.Pid)
+	logrus.WithFields(logrus.Fields{
+		"pid":     cmd.Process.Pid,
+		"command": cmdName,
+	}).Info("subcommand started")
 
 	waitErr := cmd.Wait()
 
@@ -133,6 +133,22 @@ func TestExecuteCommand_Basic(t *testing.T) {
 			t.Errorf("expected exit code 42, got %d", code)
 		}
 	})
+
+	t.Run("extra env", func(t *testing.T) {
+		t.Setenv("SYNQ_TEST_INHERITED", "inherited")
+		t.Setenv("SYNQ_TEST_OVERRIDDEN", "inherited")
+		_, stdout, _, err := ExecuteCommandWithEnv(
+			ctx,
+			[]string{"SYNQ_TEST_OVERRIDDEN=extra"},
+			"sh", "-c", "echo $SYNQ_TEST_INHERITED $SYNQ_TEST_OVERRIDDEN",
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(stdout) != "inherited extra\n" {
+			t.Errorf("expected 'inherited extra\\n', got %q", string(stdout))
+		}
+	})
 }
 
 // TestExecuteCommand_GracefulCancel: on context cancellation the wrapper
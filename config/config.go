@@ -0,0 +1,246 @@
+// Package config reads synq-dbt.yml, the optional configuration file of
+// synq-dbt, and resolves the effective settings against the environment.
+//
+// Every setting has an environment variable, and the environment always
+// wins: a value is taken from the file only when its variable is unset.
+// Within the file, the selected profile wins over the top-level values.
+// Flags, where a setting has one, win over both.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileNames are looked for, in order, next to dbt_project.yml.
+var FileNames = []string{"synq-dbt.yml", "synq-dbt.yaml"}
+
+const (
+	// PathEnv points at a configuration file, wherever it is.
+	PathEnv = "SYNQ_CONFIG"
+	// ProfileEnv selects a profile of the configuration file.
+	ProfileEnv = "SYNQ_PROFILE"
+)
+
+// Setting is a configurable value of synq-dbt.
+type Setting struct {
+	// Key is the name of the setting in synq-dbt.yml.
+	Key string
+	// Env is the environment variable of the setting.
+	Env string
+	// Default describes the built-in default, for display only.
+	Default string
+	// Secret values are masked when displayed.
+	Secret bool
+}
+
+// Settings lists every setting synq-dbt.yml can hold.
+var Settings = []Setting{
+	{Key: "token", Env: "SYNQ_TOKEN", Secret: true},
+	{Key: "api_endpoint", Env: "SYNQ_API_ENDPOINT", Default: "https://developer.synq.io/"},
+	{Key: "dbt_bin", Env: "SYNQ_DBT_BIN", Default: "dbt"},
+	{Key: "target_dir", Env: "SYNQ_TARGET_DIR", Default: "auto-detected"},
+	{Key: "cancel_grace_period", Env: "SYNQ_DBT_CANCEL_GRACE_PERIOD", Default: "15s"},
+	{Key: "upload_timeout", Env: "SYNQ_UPLOAD_TIMEOUT", Default: "30s"},
+	{Key: "retry_delays", Env: "SYNQ_UPLOAD_RETRY_DELAYS", Default: "5s,10s,15s"},
+	{Key: "log_format", Env: "SYNQ_LOG_FORMAT", Default: "text"},
+	{Key: "log_level", Env: "SYNQ_LOG_LEVEL", Default: "info"},
+	{Key: "quiet", Env: "SYNQ_QUIET", Default: "false"},
+	{Key: "pre_merge_uploads", Env: "SYNQ_PRE_MERGE_UPLOADS", Default: "false"},
+}
+
+// Sources of a Value.
+const (
+	SourceEnv     = "env"
+	SourceFile    = "file"
+	SourceProfile = "profile"
+	SourceDefault = "default"
+)
+
+// Value is the effective value of a setting.
+type Value struct {
+	Setting
+	Value string
+	// Source is one of the Source* constants.
+	Source string
+}
+
+// Display returns the value as it may be shown, with secrets masked.
+func (v Value) Display() string {
+	switch {
+	case v.Source == SourceDefault:
+		return v.Default
+	case v.Secret && len(v.Value) > 8:
+		return v.Value[:3] + "****"
+	case v.Secret && v.Value != "":
+		return "****"
+	}
+	return v.Value
+}
+
+// File is a parsed synq-dbt.yml.
+type File struct {
+	Path     string
+	values   map[string]string
+	profiles map[string]map[string]string
+}
+
+// Profiles returns the names of the file's profiles.
+func (f *File) Profiles() []string {
+	names := make([]string, 0, len(f.profiles))
+	for name := range f.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Find returns the configuration file to use: SYNQ_CONFIG when set,
+// otherwise the first of FileNames found in projectDir. It returns "" when
+// there is none.
+func Find(projectDir string) string {
+	if path := strings.TrimSpace(os.Getenv(PathEnv)); path != "" {
+		return path
+	}
+	for _, name := range FileNames {
+		path := filepath.Join(projectDir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path
+		}
+	}
+	return ""
+}
+
+// Load reads and parses the configuration file at path, interpolating
+// ${NAME} and ${NAME:-default} references to environment variables.
+func Load(path string) (*File, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]yaml.Node
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	file := &File{Path: path, profiles: map[string]map[string]string{}}
+	profiles, hasProfiles := raw["profiles"]
+	delete(raw, "profiles")
+
+	if file.values, err = settingValues(raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if hasProfiles {
+		var rawProfiles map[string]map[string]yaml.Node
+		if err := profiles.Decode(&rawProfiles); err != nil {
+			return nil, fmt.Errorf("%s: profiles must map names to settings: %w", path, err)
+		}
+		for name, rawProfile := range rawProfiles {
+			values, err := settingValues(rawProfile)
+			if err != nil {
+				return nil, fmt.Errorf("%s: profile %s: %w", path, name, err)
+			}
+			file.profiles[name] = values
+		}
+	}
+	return file, nil
+}
+
+// settingValues validates the keys and turns the values into strings. Lists
+// are joined with commas.
+func settingValues(raw map[string]yaml.Node) (map[string]string, error) {
+	known := map[string]bool{}
+	for _, setting := range Settings {
+		known[setting.Key] = true
+	}
+
+	values := map[string]string{}
+	for key, node := range raw {
+		if !known[key] {
+			return nil, fmt.Errorf("unknown setting %q", key)
+		}
+		var value string
+		switch node.Kind {
+		case yaml.ScalarNode:
+			value = node.Value
+		case yaml.SequenceNode:
+			var items []string
+			if err := node.Decode(&items); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			value = strings.Join(items, ",")
+		default:
+			return nil, fmt.Errorf("%s must be a value or a list", key)
+		}
+		values[key] = Interpolate(value)
+	}
+	return values, nil
+}
+
+var reference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// Interpolate replaces ${NAME} with the value of the environment variable
+// NAME, and ${NAME:-default} with default when NAME is unset or empty.
+func Interpolate(value string) string {
+	return reference.ReplaceAllStringFunc(value, func(match string) string {
+		groups := reference.FindStringSubmatch(match)
+		if env := os.Getenv(groups[1]); env != "" {
+			return env
+		}
+		return groups[3]
+	})
+}
+
+// Resolve returns the effective value of every setting. profile may be
+// empty; an unknown profile is an error.
+func Resolve(file *File, profile string) ([]Value, error) {
+	var profileValues map[string]string
+	if profile != "" {
+		if file == nil {
+			return nil, fmt.Errorf("profile %q selected but there is no configuration file", profile)
+		}
+		var ok bool
+		if profileValues, ok = file.profiles[profile]; !ok {
+			return nil, fmt.Errorf("%s has no profile %q (profiles: %s)", file.Path, profile, strings.Join(file.Profiles(), ", "))
+		}
+	}
+
+	values := make([]Value, 0, len(Settings))
+	for _, setting := range Settings {
+		value := Value{Setting: setting, Source: SourceDefault}
+		if env := os.Getenv(setting.Env); env != "" {
+			value.Value, value.Source = env, SourceEnv
+		} else if v, ok := profileValues[setting.Key]; ok {
+			value.Value, value.Source = v, SourceProfile
+		} else if file != nil {
+			if v, ok := file.values[setting.Key]; ok {
+				value.Value, value.Source = v, SourceFile
+			}
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// Apply exports the values taken from the configuration file to their
+// environment variables, where the rest of synq-dbt reads them from.
+func Apply(values []Value) error {
+	var errs []error
+	for _, value := range values {
+		if value.Source != SourceFile && value.Source != SourceProfile {
+			continue
+		}
+		if err := os.Setenv(value.Env, value.Value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
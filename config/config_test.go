@@ -0,0 +1,180 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testConfig = `
+token: ${TEST_SYNQ_TOKEN}
+api_endpoint: ${TEST_SYNQ_ENDPOINT:-https://api.example.com/}
+retry_delays: [1s, 2s]
+profiles:
+  staging:
+    api_endpoint: https://staging.example.com/
+    upload_timeout: 1m
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "synq-dbt.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func clearSettingsEnv(t *testing.T) {
+	t.Helper()
+	for _, setting := range Settings {
+		t.Setenv(setting.Env, "")
+	}
+}
+
+func sources(values []Value) map[string]string {
+	got := map[string]string{}
+	for _, value := range values {
+		got[value.Key] = value.Source + ":" + value.Value
+	}
+	return got
+}
+
+func TestFind(t *testing.T) {
+	t.Setenv(PathEnv, "")
+	dir := t.TempDir()
+	if got := Find(dir); got != "" {
+		t.Errorf("Find() = %q, want none", got)
+	}
+
+	path := filepath.Join(dir, "synq-dbt.yaml")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := Find(dir); got != path {
+		t.Errorf("Find() = %q, want %q", got, path)
+	}
+
+	t.Setenv(PathEnv, "/etc/synq-dbt.yml")
+	if got := Find(dir); got != "/etc/synq-dbt.yml" {
+		t.Errorf("Find() = %q, want SYNQ_CONFIG", got)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	clearSettingsEnv(t)
+	t.Setenv("TEST_SYNQ_TOKEN", "st-secret-token")
+	t.Setenv("TEST_SYNQ_ENDPOINT", "")
+
+	file, err := Load(writeConfig(t, testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profiles := file.Profiles(); len(profiles) != 1 || profiles[0] != "staging" {
+		t.Errorf("Profiles() = %v", profiles)
+	}
+
+	tests := map[string]struct {
+		profile string
+		env     map[string]string
+		want    map[string]string
+	}{
+		"top level": {
+			want: map[string]string{
+				"token":          "file:st-secret-token",
+				"api_endpoint":   "file:https://api.example.com/",
+				"retry_delays":   "file:1s,2s",
+				"upload_timeout": "default:",
+			},
+		},
+		"profile": {
+			profile: "staging",
+			want: map[string]string{
+				"api_endpoint":   "profile:https://staging.example.com/",
+				"upload_timeout": "profile:1m",
+				"retry_delays":   "file:1s,2s",
+			},
+		},
+		"env wins": {
+			profile: "staging",
+			env:     map[string]string{"SYNQ_API_ENDPOINT": "https://env.example.com/"},
+			want: map[string]string{
+				"api_endpoint": "env:https://env.example.com/",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			values, err := Resolve(file, tt.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := sources(values)
+			for key, want := range tt.want {
+				if got[key] != want {
+					t.Errorf("%s = %q, want %q", key, got[key], want)
+				}
+			}
+		})
+	}
+
+	if _, err := Resolve(file, "prod"); err == nil {
+		t.Errorf("expected an error for an unknown profile")
+	}
+}
+
+func TestLoad_UnknownSetting(t *testing.T) {
+	if _, err := Load(writeConfig(t, "tokne: abc\n")); err == nil {
+		t.Errorf("expected an error for an unknown setting")
+	}
+	if _, err := Load(writeConfig(t, "profiles:\n  prod:\n    tokne: abc\n")); err == nil {
+		t.Errorf("expected an error for an unknown setting in a profile")
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("TEST_SYNQ_SET", "value")
+	t.Setenv("TEST_SYNQ_EMPTY", "")
+	tests := map[string]string{
+		"${TEST_SYNQ_SET}":               "value",
+		"a-${TEST_SYNQ_SET}-b":           "a-value-b",
+		"${TEST_SYNQ_EMPTY:-fallback}":   "fallback",
+		"${TEST_SYNQ_SET:-fallback}":     "value",
+		"${TEST_SYNQ_EMPTY}":             "",
+		"$TEST_SYNQ_SET is not expanded": "$TEST_SYNQ_SET is not expanded",
+	}
+	for in, want := range tests {
+		if got := Interpolate(in); got != want {
+			t.Errorf("Interpolate(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	clearSettingsEnv(t)
+	t.Setenv("SYNQ_DBT_BIN", "/usr/bin/dbt")
+	values := []Value{
+		{Setting: Setting{Key: "dbt_bin", Env: "SYNQ_DBT_BIN"}, Value: "/usr/bin/dbt", Source: SourceEnv},
+		{Setting: Setting{Key: "upload_timeout", Env: "SYNQ_UPLOAD_TIMEOUT"}, Value: "1m", Source: SourceProfile},
+		{Setting: Setting{Key: "target_dir", Env: "SYNQ_TARGET_DIR"}, Source: SourceDefault},
+	}
+	if err := Apply(values); err != nil {
+		t.Fatal(err)
+	}
+	if got := os.Getenv("SYNQ_UPLOAD_TIMEOUT"); got != "1m" {
+		t.Errorf("SYNQ_UPLOAD_TIMEOUT = %q, want 1m", got)
+	}
+	if got := os.Getenv("SYNQ_TARGET_DIR"); got != "" {
+		t.Errorf("defaults must not be exported, SYNQ_TARGET_DIR = %q", got)
+	}
+}
+
+func TestValue_Display(t *testing.T) {
+	token := Value{Setting: Setting{Secret: true}, Value: "st-secret-token", Source: SourceFile}
+	if got := token.Display(); got != "st-****" {
+		t.Errorf("Display() = %q", got)
+	}
+}
@@ -1,8 +1,10 @@
 package dbt
 
 import (
-	stdjson "encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 
@@ -14,65 +16,122 @@ var (
 	json = jsoniter.ConfigCompatibleWithStandardLibrary
 )
 
-func CollectDbtArtifacts(targetPath string) *Artifacts {
-	artifacts := &Artifacts{}
-
-	manifest, invocationId, err := readArtifact(targetPath, "manifest.json")
-	if err == nil {
-		artifacts.InvocationId = invocationId
-		artifacts.Manifest = manifest
-	}
+// coreArtifacts lists the artifacts CollectDbtArtifacts reads, in the order
+// their invocation_id is considered.
+var coreArtifacts = []struct {
+	name  string
+	field func(*Artifacts) *[]byte
+}{
+	{"manifest.json", func(a *Artifacts) *[]byte { return &a.Manifest }},
+	{"run_results.json", func(a *Artifacts) *[]byte { return &a.RunResults }},
+	{"catalog.json", func(a *Artifacts) *[]byte { return &a.Catalog }},
+	{"sources.json", func(a *Artifacts) *[]byte { return &a.Sources }},
+}
 
-	runResults, invocationId, err := readArtifact(targetPath, "run_results.json")
-	if err == nil {
-		if artifacts.InvocationId == "" {
-			artifacts.InvocationId = invocationId
-		}
+func CollectDbtArtifacts(targetPath string) *Artifacts {
+	return CollectDbtArtifactsFS(os.DirFS(targetPath), targetPath)
+}
 
-		artifacts.RunResults = runResults
-	}
+// CollectDbtArtifactsFS reads the artifacts from the root of fsys, a target
+// directory that may live in an archive or remote storage. location only
+// names it in logs.
+func CollectDbtArtifactsFS(fsys fs.FS, location string) *Artifacts {
+	artifacts := &Artifacts{Metadata: map[string]ArtifactMetadata{}}
 
-	catalog, invocationId, err := readArtifact(targetPath, "catalog.json")
-	if err == nil {
-		if artifacts.InvocationId == "" {
-			artifacts.InvocationId = invocationId
+	for _, core := range coreArtifacts {
+		content, metadata, err := readArtifact(fsys, location, core.name)
+		if err != nil {
+			continue
 		}
-
-		artifacts.Catalog = catalog
-	}
-
-	sources, invocationId, err := readArtifact(targetPath, "sources.json")
-	if err == nil {
 		if artifacts.InvocationId == "" {
-			artifacts.InvocationId = invocationId
+			artifacts.InvocationId = metadata.InvocationId
 		}
-
-		artifacts.Sources = sources
+		*core.field(artifacts) = content
+		artifacts.Metadata[core.name] = metadata
 	}
 
 	return artifacts
 }
 
-func readArtifact(directory, name string) (string, string, error) {
-	artifact, err := os.ReadFile(filepath.Join(directory, name))
+func readArtifact(fsys fs.FS, location, name string) ([]byte, ArtifactMetadata, error) {
+	artifact, err := fs.ReadFile(fsys, name)
 	if err != nil {
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			pathErr.Path = filepath.Join(location, pathErr.Path)
+		}
 		logrus.Infof("synq-dbt %s, skipping", err)
-		return "", "", err
+		return nil, ArtifactMetadata{}, err
 	}
 
 	if len(artifact) == 0 {
 		logrus.Warnf("synq-dbt %s is empty, skipping", name)
-		return "", "", fmt.Errorf("%s is empty", name)
+		return nil, ArtifactMetadata{}, fmt.Errorf("%s is empty", name)
 	}
 
-	if !stdjson.Valid(artifact) {
+	metadata, err := scanArtifact(artifact)
+	if err != nil {
 		logrus.Warnf("synq-dbt %s contains invalid JSON (file may have been modified during read), skipping", name)
-		return "", "", fmt.Errorf("%s contains invalid JSON", name)
+		return nil, ArtifactMetadata{}, fmt.Errorf("%s contains invalid JSON: %w", name, err)
+	}
+
+	logrus.Infof("synq-dbt %s found with invocation_id=`%s`", name, metadata.InvocationId)
+
+	return artifact, metadata, nil
+}
+
+// scanArtifact validates an artifact and extracts its metadata in a single
+// pass over the bytes, without building a document tree or copying
+// anything but the extracted values. It accepts exactly the documents
+// encoding/json.Valid accepts that are JSON objects.
+func scanArtifact(artifact []byte) (ArtifactMetadata, error) {
+	iter := json.BorrowIterator(artifact)
+	defer json.ReturnIterator(iter)
+
+	var metadata ArtifactMetadata
+	if iter.WhatIsNext() != jsoniter.ObjectValue {
+		return metadata, errors.New("not a JSON object")
 	}
 
-	invocationId := json.Get(artifact, "metadata", "invocation_id").ToString()
+	iter.ReadObjectCB(func(iter *jsoniter.Iterator, field string) bool {
+		if field != "metadata" || iter.WhatIsNext() != jsoniter.ObjectValue {
+			iter.Skip()
+			return true
+		}
+		iter.ReadObjectCB(func(iter *jsoniter.Iterator, field string) bool {
+			switch {
+			case field == "invocation_id" && iter.WhatIsNext() == jsoniter.StringValue:
+				metadata.InvocationId = iter.ReadString()
+			case field == "generated_at" && iter.WhatIsNext() == jsoniter.StringValue:
+				metadata.GeneratedAt = iter.ReadString()
+			case field == "env" && iter.WhatIsNext() == jsoniter.ObjectValue:
+				iter.ReadObjectCB(func(iter *jsoniter.Iterator, name string) bool {
+					if iter.WhatIsNext() != jsoniter.StringValue {
+						iter.Skip()
+						return true
+					}
+					if metadata.Env == nil {
+						metadata.Env = map[string]string{}
+					}
+					metadata.Env[name] = iter.ReadString()
+					return true
+				})
+			default:
+				iter.Skip()
+			}
+			return true
+		})
+		return true
+	})
+	if iter.Error != nil {
+		return ArtifactMetadata{}, iter.Error
+	}
 
-	logrus.Infof("synq-dbt %s found with invocation_id=`%s`", name, invocationId)
+	// Anything but whitespace after the top-level object is invalid.
+	iter.WhatIsNext()
+	if iter.Error != io.EOF {
+		return ArtifactMetadata{}, errors.New("unexpected data after top-level object")
+	}
 
-	return string(artifact), invocationId, nil
+	return metadata, nil
 }
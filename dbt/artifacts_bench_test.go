@@ -0,0 +1,104 @@
+package dbt
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// The benchmarks below track what collecting the artifacts of a large
+// project costs the wrapper, which runs in memory-tight pods next to dbt.
+// Peak RSS is a process-wide high-water mark, so run one benchmark per
+// process to compare numbers:
+//
+//	go test ./dbt -run '^$' -bench 'BenchmarkCollectDbtArtifacts$' -benchmem
+//
+// SYNQ_BENCH_MANIFEST_MB sets the generated manifest size (default 80).
+
+func benchmarkTargetDir(b *testing.B) string {
+	b.Helper()
+
+	sizeMb := 80
+	if v, err := strconv.Atoi(os.Getenv("SYNQ_BENCH_MANIFEST_MB")); err == nil && v > 0 {
+		sizeMb = v
+	}
+
+	dir := b.TempDir()
+	path := filepath.Join(dir, "manifest.json")
+	file, err := os.Create(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	sql := strings.Repeat("select * from some_table where some_column = 'some value' ", 16)
+	fmt.Fprint(file, `{"metadata": {"invocation_id": "bench", "generated_at": "2024-05-02T10:00:00Z"}, "nodes": {`)
+	written := 0
+	for i := 0; written < sizeMb<<20; i++ {
+		if i > 0 {
+			fmt.Fprint(file, ",")
+		}
+		n, _ := fmt.Fprintf(
+			file,
+			`"model.bench.model_%d": {"name": "model_%d", "raw_code": %q, "depends_on": {"nodes": ["model.bench.model_%d"]}}`,
+			i, i, sql, i-1,
+		)
+		written += n
+	}
+	fmt.Fprint(file, `}}`)
+	if err := file.Close(); err != nil {
+		b.Fatal(err)
+	}
+
+	return dir
+}
+
+// reportPeakRSS reports the process' peak resident set size in MiB.
+func reportPeakRSS(b *testing.B) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return
+	}
+	maxRss := float64(usage.Maxrss) // KiB on Linux, bytes on macOS
+	if runtime.GOOS == "darwin" {
+		maxRss /= 1024
+	}
+	b.ReportMetric(maxRss/1024, "peak-rss-MiB")
+}
+
+func BenchmarkCollectDbtArtifacts(b *testing.B) {
+	dir := benchmarkTargetDir(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		artifacts := CollectDbtArtifacts(dir)
+		if artifacts.InvocationId != "bench" {
+			b.Fatalf("unexpected invocation_id %q", artifacts.InvocationId)
+		}
+	}
+
+	reportPeakRSS(b)
+}
+
+func BenchmarkScanArtifact(b *testing.B) {
+	artifact, err := os.ReadFile(filepath.Join(benchmarkTargetDir(b), "manifest.json"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(artifact)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := scanArtifact(artifact); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	reportPeakRSS(b)
+}
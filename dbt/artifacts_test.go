@@ -0,0 +1,62 @@
+package dbt
+
+import (
+	stdjson "encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestScanArtifact(t *testing.T) {
+	doc := `{"metadata": {"dbt_version": "1.8.0", "generated_at": "2024-05-02T10:00:00.123456Z", "invocation_id": "abc", "env": {"A": "b"}}, "nodes": {"a": [1, 2.5e3, -0.1, true, false, null, {"x": "y\"z"}]}}`
+
+	metadata, err := scanArtifact([]byte(doc))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if metadata.InvocationId != "abc" || metadata.GeneratedAt != "2024-05-02T10:00:00.123456Z" || metadata.Env["A"] != "b" {
+		t.Errorf("unexpected metadata %+v", metadata)
+	}
+
+	// Files being rewritten by dbt while we read them show up truncated,
+	// every prefix must be rejected exactly like encoding/json does.
+	for i := 0; i < len(doc); i++ {
+		prefix := []byte(doc[:i])
+		if _, err := scanArtifact(prefix); (err == nil) != stdjson.Valid(prefix) {
+			t.Errorf("prefix %q: scanArtifact err=%v, encoding/json valid=%v", prefix, err, stdjson.Valid(prefix))
+		}
+	}
+
+	for _, invalid := range []string{
+		`[]`,
+		`{"a": 01}`,
+		`{"a": tru}`,
+		`{"a": 1,}`,
+		`{"a" 1}`,
+		`{"a": 1} x`,
+		`{"a": 1}{}`,
+		`{"a": "\q"}`,
+		`{"a": [1 2]}`,
+	} {
+		if _, err := scanArtifact([]byte(invalid)); err == nil {
+			t.Errorf("%q should be rejected", invalid)
+		}
+	}
+}
+
+func TestCollectDbtArtifacts_SkipsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "manifest.json"), artifactJson("inv", "2024-05-02T10:00:00Z"))
+	writeFile(t, filepath.Join(dir, "run_results.json"), `{"metadata": {"invocation_id": "inv"}, "results": [`)
+	writeFile(t, filepath.Join(dir, "catalog.json"), "")
+
+	artifacts := CollectDbtArtifacts(dir)
+	if artifacts.InvocationId != "inv" || len(artifacts.Manifest) == 0 {
+		t.Errorf("manifest.json should have been collected")
+	}
+	if artifacts.RunResults != nil || artifacts.Catalog != nil || artifacts.Sources != nil {
+		t.Errorf("truncated, empty and missing artifacts must be skipped")
+	}
+	if _, ok := artifacts.Metadata["run_results.json"]; ok {
+		t.Errorf("skipped artifacts must not have metadata")
+	}
+}
@@ -0,0 +1,190 @@
+package dbt
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ArtifactFile is an optional file collected in addition to the core dbt
+// artifacts. Name is slash-separated and relative to the target directory
+// (e.g. "semantic_manifest.json").
+type ArtifactFile struct {
+	Name    string
+	Content []byte
+}
+
+// ExtraArtifactOptions controls which optional files CollectExtraArtifacts
+// picks up. Include and Exclude hold patterns matched against ArtifactFile
+// names: path.Match globs, "dir/**" for everything below dir, or "**" for
+// everything. Nothing is collected unless it matches Include; Exclude wins
+// over Include.
+type ExtraArtifactOptions struct {
+	Include      []string
+	Exclude      []string
+	MaxFileSize  int64
+	MaxTotalSize int64
+}
+
+const (
+	defaultMaxExtraFileSize  = 10 << 20
+	defaultMaxExtraTotalSize = 50 << 20
+)
+
+// extraTargetFiles lists the optional artifacts looked up in the target
+// directory. Only files the ingest API has a DbtArtifact kind for belong
+// here, anything else would be read just to be thrown away. That rules out
+// graph_summary.json, the project's dbt_project.yml, packages.yml,
+// package-lock.yml and selectors.yml, and the compiled and run SQL of
+// executed nodes until the API accepts them; compiled SQL already travels
+// as compiled_code in run_results.json and manifest.json.
+var extraTargetFiles = []string{
+	"semantic_manifest.json",
+}
+
+// ExtraArtifactOptionsFromEnv reads the collection configuration from
+//   - SYNQ_ARTIFACTS_INCLUDE: comma-separated patterns to collect
+//   - SYNQ_ARTIFACTS_EXCLUDE: comma-separated patterns to skip
+//   - SYNQ_ARTIFACTS_MAX_FILE_SIZE: per-file cap (bytes, or with K/M/G suffix)
+//   - SYNQ_ARTIFACTS_MAX_TOTAL_SIZE: cap for all optional files together
+func ExtraArtifactOptionsFromEnv() ExtraArtifactOptions {
+	return ExtraArtifactOptions{
+		Include:      splitList(os.Getenv("SYNQ_ARTIFACTS_INCLUDE")),
+		Exclude:      splitList(os.Getenv("SYNQ_ARTIFACTS_EXCLUDE")),
+		MaxFileSize:  sizeFromEnv("SYNQ_ARTIFACTS_MAX_FILE_SIZE", defaultMaxExtraFileSize),
+		MaxTotalSize: sizeFromEnv("SYNQ_ARTIFACTS_MAX_TOTAL_SIZE", defaultMaxExtraTotalSize),
+	}
+}
+
+// CollectExtraArtifacts appends the optional files selected by options to
+// artifacts.Files.
+func CollectExtraArtifacts(artifacts *Artifacts, targetPath string, options ExtraArtifactOptions) {
+	CollectExtraArtifactsFS(artifacts, os.DirFS(targetPath), options)
+}
+
+// CollectExtraArtifactsFS is CollectExtraArtifacts for a target directory
+// that may live in an archive or remote storage.
+func CollectExtraArtifactsFS(artifacts *Artifacts, targetFS fs.FS, options ExtraArtifactOptions) {
+	if artifacts == nil || len(options.Include) == 0 {
+		return
+	}
+
+	collector := &extraCollector{options: options, artifacts: artifacts}
+	for _, name := range extraTargetFiles {
+		collector.add(targetFS, name)
+	}
+
+	if len(artifacts.Files) > 0 {
+		logrus.Infof("synq-dbt collected %d additional files (%d bytes)", len(artifacts.Files), collector.total)
+	}
+}
+
+type extraCollector struct {
+	options   ExtraArtifactOptions
+	artifacts *Artifacts
+	total     int64
+}
+
+func (c *extraCollector) add(fsys fs.FS, name string) {
+	if !c.options.selects(name) {
+		return
+	}
+
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logrus.Infof("synq-dbt %s, skipping", err)
+		}
+		return
+	}
+	if c.options.MaxFileSize > 0 && info.Size() > c.options.MaxFileSize {
+		logrus.Warnf("synq-dbt %s is %d bytes, over the %d byte limit, skipping", name, info.Size(), c.options.MaxFileSize)
+		return
+	}
+	if c.options.MaxTotalSize > 0 && c.total+info.Size() > c.options.MaxTotalSize {
+		logrus.Warnf("synq-dbt %s would exceed the %d byte limit for additional files, skipping", name, c.options.MaxTotalSize)
+		return
+	}
+
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		logrus.Infof("synq-dbt %s, skipping", err)
+		return
+	}
+
+	c.total += int64(len(content))
+	c.artifacts.Files = append(c.artifacts.Files, ArtifactFile{Name: name, Content: content})
+}
+
+func (o ExtraArtifactOptions) selects(name string) bool {
+	return matchesAny(o.Include, name) && !matchesAny(o.Exclude, name)
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if pattern == "**" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/**"); ok && strings.HasPrefix(name, prefix+"/") {
+			return true
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func sizeFromEnv(name string, fallback int64) int64 {
+	value, ok := os.LookupEnv(name)
+	if !ok || strings.TrimSpace(value) == "" {
+		return fallback
+	}
+	size, err := parseSize(value)
+	if err != nil {
+		logrus.Warnf("ignoring %s=%q (must be a size like 1048576, 512K or 10M): %v", name, value, err)
+		return fallback
+	}
+	return size
+}
+
+// parseSize parses a byte count with an optional binary K, M or G suffix.
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if size < 0 {
+		return 0, errors.New("size must not be negative")
+	}
+	return size * multiplier, nil
+}
@@ -0,0 +1,114 @@
+package dbt
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func collectedNames(artifacts *Artifacts) []string {
+	var names []string
+	for _, file := range artifacts.Files {
+		names = append(names, file.Name)
+	}
+	return names
+}
+
+func TestCollectExtraArtifacts(t *testing.T) {
+	target := t.TempDir()
+	writeFile(t, filepath.Join(target, "semantic_manifest.json"), `{"semantic_models": []}`)
+	// Files the ingest API has no field for must not be read, even
+	// when they match the include patterns.
+	writeFile(t, filepath.Join(target, "graph_summary.json"), "{}")
+	writeFile(t, filepath.Join(target, "compiled/shop/models/orders.sql"), "select 1")
+
+	collect := func(options ExtraArtifactOptions) []string {
+		artifacts := &Artifacts{}
+		CollectExtraArtifacts(artifacts, target, options)
+		return collectedNames(artifacts)
+	}
+
+	t.Run("nothing by default", func(t *testing.T) {
+		if got := collect(ExtraArtifactOptions{}); len(got) != 0 {
+			t.Errorf("expected no files without include patterns, got %v", got)
+		}
+	})
+
+	t.Run("only files the ingest API accepts", func(t *testing.T) {
+		got := collect(ExtraArtifactOptions{Include: []string{"**"}})
+		if want := []string{"semantic_manifest.json"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("exclude", func(t *testing.T) {
+		got := collect(ExtraArtifactOptions{Include: []string{"*.json"}, Exclude: []string{"semantic_*"}})
+		if len(got) != 0 {
+			t.Errorf("got %v, want nothing", got)
+		}
+	})
+
+	t.Run("size caps", func(t *testing.T) {
+		if got := collect(ExtraArtifactOptions{Include: []string{"**"}, MaxFileSize: 10}); len(got) != 0 {
+			t.Errorf("per-file cap: got %v, want nothing", got)
+		}
+		if got := collect(ExtraArtifactOptions{Include: []string{"**"}, MaxTotalSize: 10}); len(got) != 0 {
+			t.Errorf("total cap: got %v, want nothing", got)
+		}
+	})
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"1048576": 1048576,
+		"512K":    512 << 10,
+		"10M":     10 << 20,
+		"10MiB":   10 << 20,
+		"1gb":     1 << 30,
+	}
+	for input, want := range tests {
+		got, err := parseSize(input)
+		if err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", input, got, err, want)
+		}
+	}
+
+	for _, input := range []string{"", "ten", "-1", "5T"} {
+		if _, err := parseSize(input); err == nil {
+			t.Errorf("parseSize(%q) should fail", input)
+		}
+	}
+}
+
+func TestExtraArtifactOptionsFromEnv(t *testing.T) {
+	t.Setenv("SYNQ_ARTIFACTS_INCLUDE", " semantic_manifest.json, target/** ,")
+	t.Setenv("SYNQ_ARTIFACTS_EXCLUDE", "")
+	t.Setenv("SYNQ_ARTIFACTS_MAX_FILE_SIZE", "1M")
+	t.Setenv("SYNQ_ARTIFACTS_MAX_TOTAL_SIZE", "not-a-size")
+
+	options := ExtraArtifactOptionsFromEnv()
+	if got := strings.Join(options.Include, "|"); got != "semantic_manifest.json|target/**" {
+		t.Errorf("Include = %q", got)
+	}
+	if len(options.Exclude) != 0 {
+		t.Errorf("Exclude = %v, want empty", options.Exclude)
+	}
+	if options.MaxFileSize != 1<<20 {
+		t.Errorf("MaxFileSize = %d", options.MaxFileSize)
+	}
+	if options.MaxTotalSize != defaultMaxExtraTotalSize {
+		t.Errorf("MaxTotalSize = %d, want default", options.MaxTotalSize)
+	}
+}
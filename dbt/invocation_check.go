@@ -0,0 +1,169 @@
+package dbt
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// InvocationIdPolicy decides what happens to collected artifacts whose
+// invocation_id differs from the rest, e.g. a fresh manifest.json next to a
+// run_results.json left over from an earlier dbt invocation.
+type InvocationIdPolicy string
+
+const (
+	// InvocationIdPolicyWarn logs the mismatch and uploads everything together.
+	InvocationIdPolicyWarn InvocationIdPolicy = "warn"
+	// InvocationIdPolicyDrop leaves mismatched artifacts out of the upload.
+	InvocationIdPolicyDrop InvocationIdPolicy = "drop"
+	// InvocationIdPolicySplit uploads mismatched artifacts as separate
+	// invocations, one per invocation_id.
+	InvocationIdPolicySplit InvocationIdPolicy = "split"
+)
+
+// InvocationIdCheck is the outcome of ApplyInvocationIdPolicy.
+type InvocationIdCheck struct {
+	Policy InvocationIdPolicy
+	// Mismatched maps each artifact whose invocation_id differs from
+	// Artifacts.InvocationId to its own invocation_id. Empty when all
+	// artifacts agree.
+	Mismatched map[string]string
+	// SplitFrom is set on artifacts split off by InvocationIdPolicySplit and
+	// holds the invocation_id of the run they were collected with.
+	SplitFrom string
+}
+
+// Consistent reports whether all artifacts shared one invocation_id.
+func (c *InvocationIdCheck) Consistent() bool {
+	return len(c.Mismatched) == 0
+}
+
+// InvocationIdPolicyFromEnv reads the policy from SYNQ_INVOCATION_ID_POLICY,
+// defaulting to InvocationIdPolicyWarn.
+func InvocationIdPolicyFromEnv() InvocationIdPolicy {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv("SYNQ_INVOCATION_ID_POLICY")))
+	switch policy := InvocationIdPolicy(value); policy {
+	case InvocationIdPolicyWarn, InvocationIdPolicyDrop, InvocationIdPolicySplit:
+		return policy
+	case "":
+	default:
+		logrus.Warnf("ignoring SYNQ_INVOCATION_ID_POLICY=%q (must be warn, drop or split)", value)
+	}
+	return InvocationIdPolicyWarn
+}
+
+// ApplyInvocationIdPolicy checks that all collected core artifacts belong to
+// the same dbt invocation. The reference invocation is the one of the most
+// recently generated artifact. Artifacts from other invocations are handled
+// according to policy, and the outcome is recorded in
+// artifacts.InvocationIdCheck.
+//
+// The returned slice always starts with artifacts itself, narrowed to the
+// reference invocation for drop and split. With split, one further Artifacts
+// per other invocation_id follows, oldest last.
+func ApplyInvocationIdPolicy(artifacts *Artifacts, policy InvocationIdPolicy) []*Artifacts {
+	if artifacts == nil {
+		return nil
+	}
+
+	check := &InvocationIdCheck{Policy: policy, Mismatched: map[string]string{}}
+	artifacts.InvocationIdCheck = check
+
+	reference := referenceInvocationId(artifacts)
+	if reference == "" {
+		return []*Artifacts{artifacts}
+	}
+	artifacts.InvocationId = reference
+
+	for _, core := range coreArtifacts {
+		metadata, ok := artifacts.Metadata[core.name]
+		if ok && metadata.InvocationId != "" && metadata.InvocationId != reference {
+			check.Mismatched[core.name] = metadata.InvocationId
+		}
+	}
+	if check.Consistent() {
+		return []*Artifacts{artifacts}
+	}
+
+	for name, invocationId := range check.Mismatched {
+		logrus.Warnf(
+			"synq-dbt %s has invocation_id=`%s`, expected `%s` (policy %s)",
+			name,
+			invocationId,
+			reference,
+			policy,
+		)
+	}
+
+	if policy != InvocationIdPolicyDrop && policy != InvocationIdPolicySplit {
+		return []*Artifacts{artifacts}
+	}
+
+	split := map[string]*Artifacts{}
+	for _, core := range coreArtifacts {
+		invocationId, ok := check.Mismatched[core.name]
+		if !ok {
+			continue
+		}
+		if policy == InvocationIdPolicySplit {
+			other, ok := split[invocationId]
+			if !ok {
+				other = &Artifacts{
+					InvocationId:      invocationId,
+					Metadata:          map[string]ArtifactMetadata{},
+					InvocationIdCheck: &InvocationIdCheck{Policy: policy, SplitFrom: reference},
+				}
+				split[invocationId] = other
+			}
+			*core.field(other) = *core.field(artifacts)
+			other.Metadata[core.name] = artifacts.Metadata[core.name]
+		}
+		*core.field(artifacts) = nil
+		delete(artifacts.Metadata, core.name)
+	}
+
+	result := []*Artifacts{artifacts}
+	for _, other := range split {
+		result = append(result, other)
+	}
+	sort.SliceStable(result[1:], func(i, j int) bool {
+		return latestGeneratedAt(result[1+i]).After(latestGeneratedAt(result[1+j]))
+	})
+	return result
+}
+
+// referenceInvocationId returns the invocation_id of the most recently
+// generated artifact, falling back to collection order when generated_at is
+// missing or equal.
+func referenceInvocationId(artifacts *Artifacts) string {
+	var reference string
+	var referenceGeneratedAt time.Time
+	for _, core := range coreArtifacts {
+		metadata, ok := artifacts.Metadata[core.name]
+		if !ok || metadata.InvocationId == "" {
+			continue
+		}
+		generatedAt := parseTimestamp(metadata.GeneratedAt)
+		if reference == "" || generatedAt.After(referenceGeneratedAt) {
+			reference = metadata.InvocationId
+			referenceGeneratedAt = generatedAt
+		}
+	}
+	if reference == "" {
+		return artifacts.InvocationId
+	}
+	return reference
+}
+
+func latestGeneratedAt(artifacts *Artifacts) time.Time {
+	var latest time.Time
+	for _, metadata := range artifacts.Metadata {
+		if generatedAt := parseTimestamp(metadata.GeneratedAt); generatedAt.After(latest) {
+			latest = generatedAt
+		}
+	}
+	return latest
+}
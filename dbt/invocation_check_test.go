@@ -0,0 +1,105 @@
+package dbt
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func artifactJson(invocationId, generatedAt string) string {
+	return `{"metadata": {"invocation_id": "` + invocationId + `", "generated_at": "` + generatedAt + `"}}`
+}
+
+// staleTargetDir writes a fresh manifest and catalog next to a run_results
+// left over from an older invocation.
+func staleTargetDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "manifest.json"), artifactJson("fresh", "2024-05-02T10:00:00.000000Z"))
+	writeFile(t, filepath.Join(dir, "run_results.json"), artifactJson("stale", "2024-05-01T10:00:00.000000Z"))
+	writeFile(t, filepath.Join(dir, "catalog.json"), artifactJson("fresh", "2024-05-02T10:01:00.000000Z"))
+	return dir
+}
+
+func TestApplyInvocationIdPolicy_Consistent(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "manifest.json"), artifactJson("inv", "2024-05-02T10:00:00Z"))
+	writeFile(t, filepath.Join(dir, "run_results.json"), artifactJson("inv", "2024-05-02T10:05:00Z"))
+
+	artifacts := CollectDbtArtifacts(dir)
+	got := ApplyInvocationIdPolicy(artifacts, InvocationIdPolicyDrop)
+	if len(got) != 1 || got[0] != artifacts {
+		t.Fatalf("expected the artifacts back unchanged, got %v", got)
+	}
+	if !artifacts.InvocationIdCheck.Consistent() {
+		t.Errorf("expected consistent check, got %v", artifacts.InvocationIdCheck.Mismatched)
+	}
+	if len(artifacts.RunResults) == 0 {
+		t.Error("run_results.json should be kept")
+	}
+}
+
+func TestApplyInvocationIdPolicy_Warn(t *testing.T) {
+	artifacts := CollectDbtArtifacts(staleTargetDir(t))
+	got := ApplyInvocationIdPolicy(artifacts, InvocationIdPolicyWarn)
+
+	if len(got) != 1 || len(got[0].RunResults) == 0 {
+		t.Fatal("warn must upload everything together")
+	}
+	if artifacts.InvocationId != "fresh" {
+		t.Errorf("InvocationId = %q, want fresh", artifacts.InvocationId)
+	}
+	want := map[string]string{"run_results.json": "stale"}
+	if !reflect.DeepEqual(artifacts.InvocationIdCheck.Mismatched, want) {
+		t.Errorf("Mismatched = %v, want %v", artifacts.InvocationIdCheck.Mismatched, want)
+	}
+}
+
+func TestApplyInvocationIdPolicy_Drop(t *testing.T) {
+	artifacts := CollectDbtArtifacts(staleTargetDir(t))
+	got := ApplyInvocationIdPolicy(artifacts, InvocationIdPolicyDrop)
+
+	if len(got) != 1 {
+		t.Fatalf("expected one invocation, got %d", len(got))
+	}
+	if len(artifacts.RunResults) != 0 {
+		t.Error("stale run_results.json should have been dropped")
+	}
+	if len(artifacts.Manifest) == 0 || len(artifacts.Catalog) == 0 {
+		t.Error("fresh artifacts must be kept")
+	}
+}
+
+func TestApplyInvocationIdPolicy_Split(t *testing.T) {
+	artifacts := CollectDbtArtifacts(staleTargetDir(t))
+	got := ApplyInvocationIdPolicy(artifacts, InvocationIdPolicySplit)
+
+	if len(got) != 2 {
+		t.Fatalf("expected two invocations, got %d", len(got))
+	}
+	if got[0].InvocationId != "fresh" || len(got[0].RunResults) != 0 || len(got[0].Manifest) == 0 {
+		t.Errorf("first invocation should hold the fresh artifacts only")
+	}
+	stale := got[1]
+	if stale.InvocationId != "stale" || len(stale.RunResults) == 0 || len(stale.Manifest) != 0 {
+		t.Errorf("second invocation should hold the stale run_results only")
+	}
+	if stale.InvocationIdCheck.SplitFrom != "fresh" {
+		t.Errorf("SplitFrom = %q, want fresh", stale.InvocationIdCheck.SplitFrom)
+	}
+}
+
+func TestInvocationIdPolicyFromEnv(t *testing.T) {
+	tests := map[string]InvocationIdPolicy{
+		"":        InvocationIdPolicyWarn,
+		"split":   InvocationIdPolicySplit,
+		" DROP ":  InvocationIdPolicyDrop,
+		"explode": InvocationIdPolicyWarn,
+	}
+	for value, want := range tests {
+		t.Setenv("SYNQ_INVOCATION_ID_POLICY", value)
+		if got := InvocationIdPolicyFromEnv(); got != want {
+			t.Errorf("SYNQ_INVOCATION_ID_POLICY=%q: got %q, want %q", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package dbt
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// manifestResource holds the fields of a manifest.json resource synq-dbt
+// looks at.
+type manifestResource struct {
+	UniqueId         string `json:"unique_id"`
+	Name             string `json:"name"`
+	Alias            string `json:"alias"`
+	Schema           string `json:"schema"`
+	Database         string `json:"database"`
+	PackageName      string `json:"package_name"`
+	OriginalFilePath string `json:"original_file_path"`
+	PatchPath        string `json:"patch_path"`
+}
+
+// manifestIndex is manifest.json parsed down to manifestResource. It is
+// built at most once per manifest, see Artifacts.manifestIndex, and shared
+// by everything that needs to look up nodes.
+type manifestIndex struct {
+	// source is the manifest the index was built from.
+	source []byte
+	// invalid is set when source could not be parsed.
+	invalid bool
+
+	Metadata struct {
+		ProjectName string `json:"project_name"`
+	} `json:"metadata"`
+	Nodes          map[string]manifestResource `json:"nodes"`
+	Sources        map[string]manifestResource `json:"sources"`
+	Macros         map[string]manifestResource `json:"macros"`
+	Exposures      map[string]manifestResource `json:"exposures"`
+	Metrics        map[string]manifestResource `json:"metrics"`
+	SemanticModels map[string]manifestResource `json:"semantic_models"`
+	SavedQueries   map[string]manifestResource `json:"saved_queries"`
+	UnitTests      map[string]manifestResource `json:"unit_tests"`
+}
+
+// manifestIndex returns the index of a.Manifest, parsing it on first use.
+// It is rebuilt only when a.Manifest is replaced. Returns nil without a
+// manifest; an invalid manifest yields an empty index.
+func (a *Artifacts) manifestIndex() *manifestIndex {
+	if len(a.Manifest) == 0 {
+		return nil
+	}
+	if index := a.index; index != nil && len(index.source) == len(a.Manifest) && &index.source[0] == &a.Manifest[0] {
+		return index
+	}
+
+	index := &manifestIndex{source: a.Manifest}
+	if err := json.Unmarshal(a.Manifest, index); err != nil {
+		logrus.Debugf("synq-dbt failed to parse manifest.json for node lookup: %v", err)
+		index = &manifestIndex{source: a.Manifest, invalid: true}
+	}
+	a.index = index
+	return index
+}
+
+// NodesByFile maps the project files of the manifest, by original_file_path,
+// to the unique ids of the resources defined in them. A model's properties
+// file (its patch_path) maps to the model too, so a changed schema.yml
+// points at the models whose tests and docs it holds. Paths are
+// slash-separated and relative to the project directory; resources of
+// installed packages are left out.
+func (a *Artifacts) NodesByFile() map[string][]string {
+	index := a.manifestIndex()
+	if index == nil || index.invalid {
+		return nil
+	}
+
+	byFile := map[string][]string{}
+	add := func(file, uniqueId string) {
+		if file == "" {
+			return
+		}
+		file = filepath.ToSlash(file)
+		for _, existing := range byFile[file] {
+			if existing == uniqueId {
+				return
+			}
+		}
+		byFile[file] = append(byFile[file], uniqueId)
+	}
+	for _, resources := range []map[string]manifestResource{
+		index.Nodes, index.Sources, index.Macros, index.Exposures,
+		index.Metrics, index.SemanticModels, index.SavedQueries, index.UnitTests,
+	} {
+		for uniqueId, r := range resources {
+			if r.UniqueId != "" {
+				uniqueId = r.UniqueId
+			}
+			if project := index.Metadata.ProjectName; project != "" && r.PackageName != "" && r.PackageName != project {
+				continue
+			}
+			add(r.OriginalFilePath, uniqueId)
+			// patch_path is "<package>://models/schema.yml".
+			if _, patch, ok := strings.Cut(r.PatchPath, "://"); ok {
+				add(patch, uniqueId)
+			}
+		}
+	}
+	for _, ids := range byFile {
+		sort.Strings(ids)
+	}
+	return byFile
+}
@@ -0,0 +1,56 @@
+package dbt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNodesByFile(t *testing.T) {
+	manifest := []byte(`{
+		"metadata": {"project_name": "shop"},
+		"nodes": {
+			"model.shop.orders": {"unique_id": "model.shop.orders", "package_name": "shop", "original_file_path": "models/orders.sql", "patch_path": "shop://models/schema.yml"},
+			"model.shop.customers": {"unique_id": "model.shop.customers", "package_name": "shop", "original_file_path": "models/customers.sql", "patch_path": "shop://models/schema.yml"},
+			"test.shop.not_null_orders_id.abc": {"unique_id": "test.shop.not_null_orders_id.abc", "package_name": "shop", "original_file_path": "models/schema.yml"},
+			"seed.shop.countries": {"unique_id": "seed.shop.countries", "package_name": "shop", "original_file_path": "seeds/countries.csv"},
+			"model.dbt_utils.helper": {"unique_id": "model.dbt_utils.helper", "package_name": "dbt_utils", "original_file_path": "models/helper.sql"}
+		},
+		"sources": {
+			"source.shop.raw.orders": {"unique_id": "source.shop.raw.orders", "package_name": "shop", "original_file_path": "models/sources.yml"}
+		},
+		"macros": {
+			"macro.shop.cents_to_dollars": {"unique_id": "macro.shop.cents_to_dollars", "package_name": "shop", "original_file_path": "macros/cents.sql"}
+		}
+	}`)
+
+	want := map[string][]string{
+		"models/orders.sql":    {"model.shop.orders"},
+		"models/customers.sql": {"model.shop.customers"},
+		"models/schema.yml":    {"model.shop.customers", "model.shop.orders", "test.shop.not_null_orders_id.abc"},
+		"models/sources.yml":   {"source.shop.raw.orders"},
+		"seeds/countries.csv":  {"seed.shop.countries"},
+		"macros/cents.sql":     {"macro.shop.cents_to_dollars"},
+	}
+	if got := (&Artifacts{Manifest: manifest}).NodesByFile(); !reflect.DeepEqual(got, want) {
+		t.Errorf("NodesByFile() = %v, want %v", got, want)
+	}
+	if got := (&Artifacts{Manifest: []byte("not json")}).NodesByFile(); got != nil {
+		t.Errorf("expected nil for an invalid manifest, got %v", got)
+	}
+}
+
+func TestManifestIndex_ParsedOnce(t *testing.T) {
+	artifacts := &Artifacts{Manifest: []byte(`{"nodes": {"model.shop.orders": {"name": "orders"}}}`)}
+	index := artifacts.manifestIndex()
+	if index == nil || index.Nodes["model.shop.orders"].Name != "orders" {
+		t.Fatalf("unexpected index %+v", index)
+	}
+	if artifacts.manifestIndex() != index {
+		t.Error("manifest was parsed again")
+	}
+
+	artifacts.Manifest = []byte(`{"nodes": {}}`)
+	if artifacts.manifestIndex() == index {
+		t.Error("index not rebuilt for a replaced manifest")
+	}
+}
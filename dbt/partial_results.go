@@ -0,0 +1,454 @@
+package dbt
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StatusCancelled marks nodes that dbt started but never reported as
+// finished because the process was interrupted or crashed. It is not one of
+// dbt's own run_results statuses; it only ever appears in synthesized,
+// partial run_results documents.
+const StatusCancelled = "cancelled"
+
+const runResultsSchemaVersion = "https://schemas.getdbt.com/dbt/run-results/v5.json"
+
+// SynthesizeRunResults rebuilds a best-effort run_results.json from dbt's
+// console output when dbt was killed (e.g. after the CancelGracePeriod
+// escalation) or crashed before it could write its own. Both dbt's
+// structured JSON log lines (--log-format json) and its default text output
+// are understood. Nodes that started but never finished are reported as
+// StatusCancelled. startedAt, when the run started, dates the bare
+// HH:MM:SS timestamps of the text output.
+//
+// It only acts when run_results.json is missing, or is left over from a
+// different invocation than the manifest dbt wrote for this run. Returns
+// true when artifacts.RunResults was replaced by a synthesized document.
+func SynthesizeRunResults(artifacts *Artifacts, stdOut []byte, startedAt time.Time) bool {
+	if artifacts == nil || len(stdOut) == 0 {
+		return false
+	}
+
+	if len(artifacts.RunResults) > 0 {
+		manifestId := invocationIdOf(artifacts.Manifest)
+		if manifestId == "" || invocationIdOf(artifacts.RunResults) == manifestId {
+			return false
+		}
+		logrus.Infof("synq-dbt run_results.json belongs to a previous invocation, rebuilding it from dbt output")
+	}
+
+	parsed := parseNodeEvents(stdOut, startedAt)
+	if len(parsed.nodes) == 0 {
+		return false
+	}
+
+	invocationId := parsed.invocationId
+	if invocationId == "" {
+		invocationId = artifacts.InvocationId
+	}
+
+	results := parsed.results(newRelationIndex(artifacts.manifestIndex()))
+	if len(results) == 0 {
+		return false
+	}
+
+	generatedAt := time.Now().UTC().Format(time.RFC3339Nano)
+	doc := map[string]any{
+		"metadata": map[string]any{
+			"dbt_schema_version": runResultsSchemaVersion,
+			"dbt_version":        parsed.dbtVersion,
+			"generated_at":       generatedAt,
+			"invocation_id":      invocationId,
+			"env":                map[string]string{},
+			"synq_partial":       true,
+		},
+		"results":      results,
+		"elapsed_time": parsed.elapsed(),
+		"args":         map[string]any{},
+	}
+
+	runResults, err := json.Marshal(doc)
+	if err != nil {
+		logrus.Warnf("synq-dbt failed to synthesize run_results.json: %v", err)
+		return false
+	}
+
+	logrus.Infof("synq-dbt synthesized partial run_results.json with %d nodes from dbt output", len(results))
+
+	artifacts.RunResults = runResults
+	artifacts.PartialRunResults = true
+	if artifacts.Metadata == nil {
+		artifacts.Metadata = map[string]ArtifactMetadata{}
+	}
+	artifacts.Metadata["run_results.json"] = ArtifactMetadata{
+		InvocationId: invocationId,
+		GeneratedAt:  generatedAt,
+	}
+	if artifacts.InvocationId == "" {
+		artifacts.InvocationId = invocationId
+	}
+	return true
+}
+
+func invocationIdOf(artifact []byte) string {
+	if len(artifact) == 0 {
+		return ""
+	}
+	return json.Get(artifact, "metadata", "invocation_id").ToString()
+}
+
+// nodeEvent accumulates what dbt reported about a single node.
+type nodeEvent struct {
+	// key is the unique_id for structured logs, or the "N of M" index for
+	// text output where the unique_id is not printed.
+	key           string
+	uniqueId      string
+	name          string
+	status        string
+	message       string
+	failures      *int
+	executionTime float64
+	startedAt     time.Time
+	completedAt   time.Time
+	finished      bool
+	order         int
+}
+
+type nodeEvents struct {
+	nodes        map[string]*nodeEvent
+	invocationId string
+	dbtVersion   string
+	firstSeen    time.Time
+	lastSeen     time.Time
+
+	// runStart and lastClock place text timestamps, see clockTime.
+	runStart  time.Time
+	lastClock time.Time
+}
+
+func (e *nodeEvents) node(key string) *nodeEvent {
+	n, ok := e.nodes[key]
+	if !ok {
+		n = &nodeEvent{key: key, order: len(e.nodes)}
+		e.nodes[key] = n
+	}
+	return n
+}
+
+func (e *nodeEvents) seen(ts time.Time) {
+	if ts.IsZero() {
+		return
+	}
+	if e.firstSeen.IsZero() || ts.Before(e.firstSeen) {
+		e.firstSeen = ts
+	}
+	if ts.After(e.lastSeen) {
+		e.lastSeen = ts
+	}
+}
+
+func (e *nodeEvents) elapsed() float64 {
+	if e.firstSeen.IsZero() {
+		return 0
+	}
+	return e.lastSeen.Sub(e.firstSeen).Seconds()
+}
+
+func parseNodeEvents(stdOut []byte, startedAt time.Time) *nodeEvents {
+	if startedAt.IsZero() {
+		startedAt = time.Now()
+	}
+	events := &nodeEvents{nodes: map[string]*nodeEvent{}, runStart: startedAt}
+
+	scanner := bufio.NewScanner(bytes.NewReader(stdOut))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] == '{' {
+			events.parseJsonLine(line)
+		} else {
+			events.parseTextLine(string(line))
+		}
+	}
+
+	return events
+}
+
+// structuredLogLine is the subset of a dbt structured log event we need.
+type structuredLogLine struct {
+	Info struct {
+		Name         string `json:"name"`
+		Ts           string `json:"ts"`
+		InvocationId string `json:"invocation_id"`
+	} `json:"info"`
+	Data struct {
+		Version  string `json:"version"`
+		NodeInfo *struct {
+			UniqueId       string `json:"unique_id"`
+			NodeName       string `json:"node_name"`
+			NodeStatus     string `json:"node_status"`
+			NodeStartedAt  string `json:"node_started_at"`
+			NodeFinishedAt string `json:"node_finished_at"`
+		} `json:"node_info"`
+		RunResult *struct {
+			Status        string  `json:"status"`
+			Message       string  `json:"message"`
+			Failures      *int    `json:"failures"`
+			ExecutionTime float64 `json:"execution_time"`
+		} `json:"run_result"`
+	} `json:"data"`
+}
+
+func (e *nodeEvents) parseJsonLine(line []byte) {
+	var event structuredLogLine
+	if err := json.Unmarshal(line, &event); err != nil {
+		return
+	}
+
+	if event.Info.InvocationId != "" {
+		e.invocationId = event.Info.InvocationId
+	}
+	if event.Info.Name == "MainReportVersion" && event.Data.Version != "" {
+		e.dbtVersion = strings.TrimPrefix(event.Data.Version, "=")
+	}
+	e.seen(parseTimestamp(event.Info.Ts))
+
+	info := event.Data.NodeInfo
+	if info == nil || info.UniqueId == "" {
+		return
+	}
+
+	node := e.node(info.UniqueId)
+	node.uniqueId = info.UniqueId
+	node.name = info.NodeName
+	if ts := parseTimestamp(info.NodeStartedAt); !ts.IsZero() {
+		node.startedAt = ts
+	}
+	if ts := parseTimestamp(info.NodeFinishedAt); !ts.IsZero() {
+		node.completedAt = ts
+	}
+
+	if event.Info.Name == "NodeFinished" {
+		node.finished = true
+		node.status = info.NodeStatus
+		if result := event.Data.RunResult; result != nil {
+			if result.Status != "" {
+				node.status = result.Status
+			}
+			node.message = result.Message
+			node.failures = result.Failures
+			node.executionTime = result.ExecutionTime
+		}
+	}
+}
+
+var (
+	// 12:00:01  1 of 5 START sql table model analytics.orders .......... [RUN]
+	// 12:00:05  1 of 5 OK created sql table model analytics.orders ..... [SELECT 100 in 3.21s]
+	// 12:00:05  3 of 5 FAIL 2 unique_orders_id .......................... [FAIL 2 in 0.30s]
+	textNodeLine = regexp.MustCompile(
+		`^(?:(\d{2}:\d{2}:\d{2})(?:\.\d+)?\s+)?(\d+) of (\d+) (START|OK|ERROR|PASS|FAIL|WARN|SKIP)\b\s*(.*?)\s*\.{2,}\s*\[(.*)\]\s*$`,
+	)
+	textExecutionTime = regexp.MustCompile(`in (\d+(?:\.\d+)?)s\]?$`)
+	textFailures      = regexp.MustCompile(`^(?:FAIL|WARN) (\d+)\b`)
+	textDbtVersion    = regexp.MustCompile(`Running with dbt=(\S+)`)
+	ansiEscape        = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+)
+
+var textStatuses = map[string]string{
+	"OK":    "success",
+	"ERROR": "error",
+	"PASS":  "pass",
+	"FAIL":  "fail",
+	"WARN":  "warn",
+	"SKIP":  "skipped",
+}
+
+func (e *nodeEvents) parseTextLine(line string) {
+	line = ansiEscape.ReplaceAllString(line, "")
+	if m := textDbtVersion.FindStringSubmatch(line); m != nil {
+		e.dbtVersion = m[1]
+		return
+	}
+
+	m := textNodeLine.FindStringSubmatch(line)
+	if m == nil {
+		return
+	}
+	clock, index, total, verb, description, outcome := m[1], m[2], m[3], m[4], m[5], m[6]
+
+	ts := e.clockTime(clock)
+	e.seen(ts)
+
+	node := e.node(index + "/" + total)
+	if fields := strings.Fields(description); len(fields) > 0 {
+		node.name = fields[len(fields)-1]
+	}
+
+	if verb == "START" {
+		node.startedAt = ts
+		return
+	}
+
+	node.finished = true
+	node.status = textStatuses[verb]
+	node.completedAt = ts
+	node.message = outcome
+	if tm := textExecutionTime.FindStringSubmatch(outcome); tm != nil {
+		node.executionTime, _ = strconv.ParseFloat(tm[1], 64)
+	}
+	if fm := textFailures.FindStringSubmatch(outcome); fm != nil {
+		if failures, err := strconv.Atoi(fm[1]); err == nil {
+			node.failures = &failures
+		}
+	}
+}
+
+// clockTime interprets dbt's HH:MM:SS text timestamps, which are in the
+// machine's local time. The first is dated on the day the run started, or
+// the next day if that would put it before the start; later ones move on to
+// the next day whenever the clock jumps back, i.e. the run crossed midnight.
+func (e *nodeEvents) clockTime(clock string) time.Time {
+	if clock == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse("15:04:05", clock)
+	if err != nil {
+		return time.Time{}
+	}
+
+	day := e.lastClock
+	if day.IsZero() {
+		day = e.runStart.In(time.Local)
+	}
+	ts := time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+	switch {
+	case e.lastClock.IsZero():
+		if ts.Before(e.runStart.Truncate(time.Second)) {
+			ts = ts.AddDate(0, 0, 1)
+		}
+	case e.lastClock.Sub(ts) > 12*time.Hour:
+		// Lines of parallel threads may be a second or so out of order,
+		// only a large jump back is midnight.
+		ts = ts.AddDate(0, 0, 1)
+	}
+	if ts.After(e.lastClock) {
+		e.lastClock = ts
+	}
+	return ts.UTC()
+}
+
+func parseTimestamp(ts string) time.Time {
+	if ts == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}
+	}
+	return t.UTC()
+}
+
+func (e *nodeEvents) results(relations relationIndex) []map[string]any {
+	nodes := make([]*nodeEvent, 0, len(e.nodes))
+	for _, node := range e.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].order < nodes[j].order })
+
+	var results []map[string]any
+	for _, node := range nodes {
+		uniqueId := node.uniqueId
+		if uniqueId == "" {
+			uniqueId = relations.lookup(node.name)
+		}
+		if uniqueId == "" {
+			logrus.Debugf("synq-dbt could not resolve `%s` to a manifest node, skipping", node.name)
+			continue
+		}
+
+		status := node.status
+		if !node.finished {
+			status = StatusCancelled
+			node.message = "interrupted before dbt reported a result"
+			if node.completedAt.IsZero() {
+				node.completedAt = e.lastSeen
+			}
+		}
+		if node.executionTime == 0 && !node.startedAt.IsZero() && node.completedAt.After(node.startedAt) {
+			node.executionTime = node.completedAt.Sub(node.startedAt).Seconds()
+		}
+
+		var timing []map[string]string
+		if !node.startedAt.IsZero() {
+			timing = append(timing, map[string]string{
+				"name":         "execute",
+				"started_at":   node.startedAt.Format(time.RFC3339Nano),
+				"completed_at": node.completedAt.Format(time.RFC3339Nano),
+			})
+		}
+
+		results = append(results, map[string]any{
+			"unique_id":        uniqueId,
+			"status":           status,
+			"timing":           timing,
+			"thread_id":        "",
+			"execution_time":   node.executionTime,
+			"adapter_response": map[string]any{},
+			"message":          node.message,
+			"failures":         node.failures,
+		})
+	}
+	return results
+}
+
+// relationIndex maps the names dbt prints in its text output
+// (schema.alias for relations, plain names for tests) to manifest unique_ids.
+type relationIndex map[string]string
+
+func newRelationIndex(manifest *manifestIndex) relationIndex {
+	index := relationIndex{}
+	if manifest == nil {
+		return index
+	}
+
+	for uniqueId, node := range manifest.Nodes {
+		alias := node.Alias
+		if alias == "" {
+			alias = node.Name
+		}
+		index.add(node.Name, uniqueId)
+		index.add(node.Schema+"."+alias, uniqueId)
+		index.add(node.Database+"."+node.Schema+"."+alias, uniqueId)
+	}
+	return index
+}
+
+func (r relationIndex) add(name, uniqueId string) {
+	key := strings.ToLower(name)
+	if existing, ok := r[key]; ok && existing != uniqueId {
+		// Ambiguous name, refuse to guess.
+		r[key] = ""
+		return
+	}
+	r[key] = uniqueId
+}
+
+func (r relationIndex) lookup(name string) string {
+	name = strings.ToLower(strings.Trim(name, "\"`"))
+	if uniqueId := r[name]; uniqueId != "" {
+		return uniqueId
+	}
+	// Quoted relations print as "db"."schema"."table".
+	return r[strings.ReplaceAll(name, "\"", "")]
+}
@@ -0,0 +1,164 @@
+package dbt
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const partialManifest = `{
+  "metadata": {"invocation_id": "inv-1"},
+  "nodes": {
+    "model.shop.orders": {"name": "orders", "alias": "orders", "schema": "analytics", "database": "db"},
+    "model.shop.customers": {"name": "customers", "alias": "customers", "schema": "analytics", "database": "db"},
+    "test.shop.not_null_orders_id.abc": {"name": "not_null_orders_id", "schema": "analytics_dbt_test__audit", "database": "db"}
+  }
+}`
+
+func synthesizedResults(t *testing.T, artifacts *Artifacts) map[string]string {
+	t.Helper()
+	var doc struct {
+		Metadata struct {
+			InvocationId string `json:"invocation_id"`
+			SynqPartial  bool   `json:"synq_partial"`
+		} `json:"metadata"`
+		Results []struct {
+			UniqueId string `json:"unique_id"`
+			Status   string `json:"status"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(artifacts.RunResults, &doc); err != nil {
+		t.Fatalf("synthesized run_results is not valid JSON: %v", err)
+	}
+	if !doc.Metadata.SynqPartial {
+		t.Error("synthesized run_results is not marked as partial")
+	}
+	statuses := map[string]string{}
+	for _, result := range doc.Results {
+		statuses[result.UniqueId] = result.Status
+	}
+	return statuses
+}
+
+func TestSynthesizeRunResults_TextOutput(t *testing.T) {
+	stdOut := strings.Join([]string{
+		"12:00:00  Running with dbt=1.7.4",
+		"12:00:01  1 of 3 START sql table model analytics.orders ................. [RUN]",
+		"12:00:01  2 of 3 START sql view model analytics.customers ............... [RUN]",
+		"12:00:04  1 of 3 OK created sql table model analytics.orders ............ [SELECT 100 in 3.21s]",
+		"12:00:05  3 of 3 START test not_null_orders_id .......................... [RUN]",
+		"12:00:05  3 of 3 FAIL 2 not_null_orders_id .............................. [\x1b[31mFAIL 2\x1b[0m in 0.30s]",
+		"12:00:09  Received SIGINT, cancelling",
+	}, "\n")
+
+	artifacts := &Artifacts{Manifest: []byte(partialManifest), InvocationId: "inv-1"}
+	if !SynthesizeRunResults(artifacts, []byte(stdOut), time.Time{}) {
+		t.Fatal("expected run_results to be synthesized")
+	}
+	if !artifacts.PartialRunResults {
+		t.Error("PartialRunResults not set")
+	}
+
+	got := synthesizedResults(t, artifacts)
+	want := map[string]string{
+		"model.shop.orders":                "success",
+		"model.shop.customers":             StatusCancelled,
+		"test.shop.not_null_orders_id.abc": "fail",
+	}
+	for uniqueId, status := range want {
+		if got[uniqueId] != status {
+			t.Errorf("%s: status %q, want %q", uniqueId, got[uniqueId], status)
+		}
+	}
+}
+
+func TestSynthesizeRunResults_StructuredLogs(t *testing.T) {
+	stdOut := strings.Join([]string{
+		`{"info": {"name": "MainReportVersion", "ts": "2024-01-01T12:00:00Z", "invocation_id": "inv-2"}, "data": {"version": "=1.8.0"}}`,
+		`{"info": {"name": "NodeStart", "ts": "2024-01-01T12:00:01Z", "invocation_id": "inv-2"}, "data": {"node_info": {"unique_id": "model.shop.orders", "node_status": "started", "node_started_at": "2024-01-01T12:00:01Z"}}}`,
+		`{"info": {"name": "NodeStart", "ts": "2024-01-01T12:00:01Z", "invocation_id": "inv-2"}, "data": {"node_info": {"unique_id": "model.shop.customers", "node_status": "started", "node_started_at": "2024-01-01T12:00:01Z"}}}`,
+		`{"info": {"name": "NodeFinished", "ts": "2024-01-01T12:00:03Z", "invocation_id": "inv-2"}, "data": {"node_info": {"unique_id": "model.shop.orders", "node_status": "success", "node_started_at": "2024-01-01T12:00:01Z", "node_finished_at": "2024-01-01T12:00:03Z"}, "run_result": {"status": "success", "execution_time": 2.0}}}`,
+		`not json at all`,
+	}, "\n")
+
+	artifacts := &Artifacts{}
+	if !SynthesizeRunResults(artifacts, []byte(stdOut), time.Time{}) {
+		t.Fatal("expected run_results to be synthesized")
+	}
+	if artifacts.InvocationId != "inv-2" {
+		t.Errorf("invocation id %q, want inv-2", artifacts.InvocationId)
+	}
+
+	got := synthesizedResults(t, artifacts)
+	if got["model.shop.orders"] != "success" {
+		t.Errorf("orders: status %q, want success", got["model.shop.orders"])
+	}
+	if got["model.shop.customers"] != StatusCancelled {
+		t.Errorf("customers: status %q, want %q", got["model.shop.customers"], StatusCancelled)
+	}
+}
+
+func TestSynthesizeRunResults_KeepsCurrentRunResults(t *testing.T) {
+	runResults := []byte(`{"metadata": {"invocation_id": "inv-1"}, "results": []}`)
+	artifacts := &Artifacts{Manifest: []byte(partialManifest), RunResults: runResults}
+
+	stdOut := "12:00:01  1 of 1 START sql table model analytics.orders ..... [RUN]"
+	if SynthesizeRunResults(artifacts, []byte(stdOut), time.Time{}) {
+		t.Error("run_results from the current invocation must not be replaced")
+	}
+	if string(artifacts.RunResults) != string(runResults) || artifacts.PartialRunResults {
+		t.Error("artifacts were modified")
+	}
+}
+
+func TestSynthesizeRunResults_ReplacesStaleRunResults(t *testing.T) {
+	artifacts := &Artifacts{
+		Manifest:   []byte(partialManifest),
+		RunResults: []byte(`{"metadata": {"invocation_id": "inv-old"}, "results": []}`),
+	}
+
+	stdOut := "12:00:01  1 of 1 START sql table model analytics.orders ..... [RUN]"
+	if !SynthesizeRunResults(artifacts, []byte(stdOut), time.Time{}) {
+		t.Fatal("stale run_results should be replaced")
+	}
+	if got := synthesizedResults(t, artifacts); got["model.shop.orders"] != StatusCancelled {
+		t.Errorf("orders: status %q, want %q", got["model.shop.orders"], StatusCancelled)
+	}
+}
+
+func TestSynthesizeRunResults_NoNodeOutput(t *testing.T) {
+	artifacts := &Artifacts{Manifest: []byte(partialManifest)}
+	if SynthesizeRunResults(artifacts, []byte("12:00:00  Encountered an error:\nParsing Error\n"), time.Time{}) {
+		t.Error("nothing to synthesize from output without node lines")
+	}
+	if len(artifacts.RunResults) != 0 {
+		t.Error("run_results should stay empty")
+	}
+}
+
+func TestClockTime_LocalTimeAcrossMidnight(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC+2", 2*60*60)
+	defer func() { time.Local = local }()
+
+	start := time.Date(2024, 3, 1, 23, 59, 30, 0, time.Local)
+	events := parseNodeEvents(nil, start)
+
+	for _, tc := range []struct{ clock, want string }{
+		{"23:59:31", "2024-03-01T21:59:31Z"},
+		{"23:59:59", "2024-03-01T21:59:59Z"},
+		{"23:59:58", "2024-03-01T21:59:58Z"},
+		{"00:00:02", "2024-03-01T22:00:02Z"},
+		{"00:10:00", "2024-03-01T22:10:00Z"},
+	} {
+		if got := events.clockTime(tc.clock).Format(time.RFC3339); got != tc.want {
+			t.Errorf("clockTime(%q) = %s, want %s", tc.clock, got, tc.want)
+		}
+	}
+
+	// The first line may already be past midnight.
+	events = parseNodeEvents(nil, start)
+	if got := events.clockTime("00:00:01").Format(time.RFC3339); got != "2024-03-01T22:00:01Z" {
+		t.Errorf("clockTime after midnight = %s, want 2024-03-01T22:00:01Z", got)
+	}
+}
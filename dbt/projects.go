@@ -0,0 +1,182 @@
+package dbt
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Project is a dbt project directory together with the target directory its
+// artifacts are read from.
+type Project struct {
+	Dir       string
+	TargetDir string
+}
+
+// ResolveProjects determines every dbt project whose artifacts should be
+// uploaded, for wrapped commands that run dbt in more than one project
+// (e.g. a script set as SYNQ_DBT_BIN). Sources in priority order:
+//  1. target directories with a run_results.json written during the run,
+//     when watch is not nil (see WatchRunResults)
+//  2. SYNQ_TARGET_DIRS env var: comma-separated globs of target directories.
+//     When since is set, only those with a run_results.json written since
+//     then are kept, so projects that did not run are not uploaded again.
+//  3. the single project from ResolveProjectDir and ResolveTargetDir, also
+//     when neither of the above finds a target directory
+func ResolveProjects(dbtArgs []string, watch *RunResultsWatch, since time.Time) []Project {
+	if watch != nil {
+		if targetDirs := watch.Changed(); len(targetDirs) > 0 {
+			logrus.Infof("synq-dbt found run_results.json written in %d target directories", len(targetDirs))
+			return projectsForTargetDirs(dbtArgs, targetDirs)
+		}
+		logrus.Infof("synq-dbt found no new run_results.json under %s", watch.root)
+	}
+
+	if patterns := splitList(os.Getenv("SYNQ_TARGET_DIRS")); len(patterns) > 0 {
+		targetDirs := globTargetDirs(patterns)
+		if !since.IsZero() {
+			targetDirs = writtenSince(targetDirs, since)
+		}
+		if len(targetDirs) > 0 {
+			logrus.Infof("synq-dbt using %d target directories from SYNQ_TARGET_DIRS", len(targetDirs))
+			return projectsForTargetDirs(dbtArgs, targetDirs)
+		}
+		logrus.Warnf("synq-dbt found no target directories for SYNQ_TARGET_DIRS written during the run, using the project directory")
+	}
+
+	return []Project{{
+		Dir:       ResolveProjectDir(dbtArgs),
+		TargetDir: ResolveTargetDir(dbtArgs),
+	}}
+}
+
+func globTargetDirs(patterns []string) []string {
+	seen := map[string]bool{}
+	var targetDirs []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			logrus.Warnf("synq-dbt ignoring invalid SYNQ_TARGET_DIRS pattern %q: %v", pattern, err)
+			continue
+		}
+		for _, match := range matches {
+			if info, err := os.Stat(match); err != nil || !info.IsDir() || seen[match] {
+				continue
+			}
+			seen[match] = true
+			targetDirs = append(targetDirs, match)
+		}
+	}
+	return targetDirs
+}
+
+// writtenSince keeps the target directories whose run_results.json was
+// modified at or after since. Some file systems only store whole seconds.
+func writtenSince(targetDirs []string, since time.Time) []string {
+	since = since.Truncate(time.Second)
+	var written []string
+	for _, targetDir := range targetDirs {
+		info, err := os.Stat(filepath.Join(targetDir, "run_results.json"))
+		if err != nil || info.ModTime().Before(since) {
+			logrus.Infof("synq-dbt %s has no run_results.json from this run, skipping", targetDir)
+			continue
+		}
+		written = append(written, targetDir)
+	}
+	return written
+}
+
+// projectsForTargetDirs pairs each target directory with the project it
+// belongs to: its parent when that holds a dbt_project.yml, otherwise the
+// project directory resolved from args and env.
+func projectsForTargetDirs(dbtArgs []string, targetDirs []string) []Project {
+	projects := make([]Project, 0, len(targetDirs))
+	for _, targetDir := range targetDirs {
+		projectDir := filepath.Dir(targetDir)
+		if _, err := os.Stat(filepath.Join(projectDir, "dbt_project.yml")); err != nil {
+			projectDir = ResolveProjectDir(dbtArgs)
+		}
+		projects = append(projects, Project{Dir: projectDir, TargetDir: targetDir})
+	}
+	return projects
+}
+
+// RunResultsWatch remembers which run_results.json files existed below a
+// directory before dbt ran, so the target directories dbt wrote to can be
+// discovered afterwards.
+type RunResultsWatch struct {
+	root     string
+	existing map[string]time.Time
+}
+
+// maxWatchDepth bounds how deep below the watched directory run_results.json
+// files are looked for.
+const maxWatchDepth = 6
+
+// skippedWatchDirs are never descended into while looking for run_results.json.
+var skippedWatchDirs = map[string]bool{
+	"node_modules": true,
+	"dbt_packages": true,
+	"dbt_modules":  true,
+	"venv":         true,
+	"logs":         true,
+}
+
+// WatchRunResults starts watching the directory named by
+// SYNQ_WATCH_RUN_RESULTS. Returns nil when the variable is not set.
+func WatchRunResults() *RunResultsWatch {
+	root, ok := os.LookupEnv("SYNQ_WATCH_RUN_RESULTS")
+	if !ok || strings.TrimSpace(root) == "" {
+		return nil
+	}
+
+	return &RunResultsWatch{root: root, existing: findRunResults(root)}
+}
+
+// Changed returns the target directories whose run_results.json appeared or
+// was modified since the watch started, in lexical order.
+func (w *RunResultsWatch) Changed() []string {
+	var targetDirs []string
+	for path, modTime := range findRunResults(w.root) {
+		if previous, ok := w.existing[path]; ok && !modTime.After(previous) {
+			continue
+		}
+		targetDirs = append(targetDirs, filepath.Dir(path))
+	}
+	sort.Strings(targetDirs)
+	return targetDirs
+}
+
+func findRunResults(root string) map[string]time.Time {
+	found := map[string]time.Time{}
+	rootDepth := strings.Count(filepath.Clean(root), string(filepath.Separator))
+
+	_ = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if path != root && (strings.HasPrefix(entry.Name(), ".") || skippedWatchDirs[entry.Name()]) {
+				return filepath.SkipDir
+			}
+			if strings.Count(filepath.Clean(path), string(filepath.Separator))-rootDepth >= maxWatchDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Name() != "run_results.json" {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			found[path] = info.ModTime()
+		}
+		return nil
+	})
+
+	return found
+}
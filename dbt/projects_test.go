@@ -0,0 +1,114 @@
+package dbt
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResolveProjects_TargetDirsGlob(t *testing.T) {
+	root := t.TempDir()
+	for _, project := range []string{"finance", "marketing"} {
+		writeFile(t, filepath.Join(root, project, "dbt_project.yml"), "name: "+project+"\n")
+		writeFile(t, filepath.Join(root, project, "target", "manifest.json"), "{}")
+	}
+	writeFile(t, filepath.Join(root, "loose", "target", "manifest.json"), "{}")
+
+	t.Setenv("DBT_PROJECT_DIR", "")
+	t.Setenv("SYNQ_TARGET_DIRS", filepath.Join(root, "*", "target")+", "+filepath.Join(root, "finance", "target"))
+
+	got := ResolveProjects(nil, nil, time.Time{})
+	want := []Project{
+		{Dir: filepath.Join(root, "finance"), TargetDir: filepath.Join(root, "finance", "target")},
+		{Dir: ".", TargetDir: filepath.Join(root, "loose", "target")},
+		{Dir: filepath.Join(root, "marketing"), TargetDir: filepath.Join(root, "marketing", "target")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveProjects() = %v, want %v", got, want)
+	}
+}
+
+func TestResolveProjects_Single(t *testing.T) {
+	t.Setenv("SYNQ_TARGET_DIRS", "")
+	t.Setenv("SYNQ_TARGET_DIR", "explicit")
+
+	got := ResolveProjects([]string{"run", "--project-dir", "proj"}, nil, time.Time{})
+	want := []Project{{Dir: "proj", TargetDir: "explicit"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveProjects() = %v, want %v", got, want)
+	}
+}
+
+func TestResolveProjects_TargetDirsWrittenSince(t *testing.T) {
+	root := t.TempDir()
+	start := time.Now()
+	past := start.Add(-time.Hour)
+	for _, project := range []string{"finance", "marketing"} {
+		writeFile(t, filepath.Join(root, project, "dbt_project.yml"), "name: "+project+"\n")
+		writeFile(t, filepath.Join(root, project, "target", "run_results.json"), "{}")
+	}
+	stale := filepath.Join(root, "marketing", "target", "run_results.json")
+	if err := os.Chtimes(stale, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("SYNQ_TARGET_DIR", "")
+	t.Setenv("SYNQ_TARGET_DIRS", filepath.Join(root, "*", "target"))
+
+	got := ResolveProjects(nil, nil, start)
+	want := []Project{{Dir: filepath.Join(root, "finance"), TargetDir: filepath.Join(root, "finance", "target")}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveProjects() = %v, want %v", got, want)
+	}
+
+	// Without any match the single project is still uploaded, e.g. with
+	// the output of a run that failed before writing artifacts.
+	t.Setenv("SYNQ_TARGET_DIR", "explicit")
+	t.Setenv("SYNQ_TARGET_DIRS", filepath.Join(root, "missing", "target"))
+	got = ResolveProjects([]string{"run", "--project-dir", "proj"}, nil, start)
+	want = []Project{{Dir: "proj", TargetDir: "explicit"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveProjects() without matches = %v, want %v", got, want)
+	}
+}
+
+func TestWatchRunResults(t *testing.T) {
+	root := t.TempDir()
+	past := time.Now().Add(-time.Hour)
+
+	unchanged := filepath.Join(root, "unchanged", "target", "run_results.json")
+	rewritten := filepath.Join(root, "rewritten", "target", "run_results.json")
+	for _, path := range []string{unchanged, rewritten} {
+		writeFile(t, path, "{}")
+		if err := os.Chtimes(path, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("SYNQ_WATCH_RUN_RESULTS", root)
+	watch := WatchRunResults()
+	if watch == nil {
+		t.Fatal("expected watch to start")
+	}
+
+	writeFile(t, rewritten, `{"results": []}`)
+	writeFile(t, filepath.Join(root, "created", "target", "run_results.json"), "{}")
+	writeFile(t, filepath.Join(root, "created", "dbt_packages", "pkg", "target", "run_results.json"), "{}")
+	writeFile(t, filepath.Join(root, ".hidden", "target", "run_results.json"), "{}")
+
+	got := watch.Changed()
+	want := []string{
+		filepath.Join(root, "created", "target"),
+		filepath.Join(root, "rewritten", "target"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Changed() = %v, want %v", got, want)
+	}
+
+	t.Setenv("SYNQ_WATCH_RUN_RESULTS", "")
+	if WatchRunResults() != nil {
+		t.Error("watch should be disabled without SYNQ_WATCH_RUN_RESULTS")
+	}
+}
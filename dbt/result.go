@@ -1,10 +1,80 @@
 package dbt
 
-// Artifacts holds the raw dbt artifact JSON strings collected from the target directory.
+import "time"
+
+// Artifacts holds the raw dbt artifact JSON collected from the target directory.
+// Content is kept as read from disk and handed to the request without copies,
+// manifests of large projects run into the tens of megabytes.
 type Artifacts struct {
-	Manifest     string
-	RunResults   string
-	Catalog      string
-	Sources      string
+	Manifest     []byte
+	RunResults   []byte
+	Catalog      []byte
+	Sources      []byte
 	InvocationId string
+
+	// Files holds optional artifacts and project files picked up by
+	// CollectExtraArtifacts.
+	Files []ArtifactFile
+
+	// Metadata of each core artifact that was collected, keyed by file name
+	// (e.g. "manifest.json").
+	Metadata map[string]ArtifactMetadata
+
+	// InvocationIdCheck records the outcome of ApplyInvocationIdPolicy.
+	InvocationIdCheck *InvocationIdCheck
+
+	// PartialRunResults is set when RunResults was synthesized from dbt's
+	// output by SynthesizeRunResults rather than written by dbt itself.
+	PartialRunResults bool
+
+	// index caches the parsed Manifest, see manifestIndex.
+	index *manifestIndex
+}
+
+// ArtifactMetadata holds the fields of an artifact's "metadata" object that
+// synq-dbt looks at.
+type ArtifactMetadata struct {
+	InvocationId string
+	GeneratedAt  string
+	// Env holds metadata.env: the DBT_ENV_CUSTOM_ENV_* variables dbt ran
+	// with, keyed without the prefix.
+	Env map[string]string
+}
+
+// Env returns the value of a metadata.env entry, from the first collected
+// artifact that has it.
+func (a *Artifacts) Env(name string) string {
+	for _, core := range coreArtifacts {
+		if value, ok := a.Metadata[core.name].Env[name]; ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// GeneratedAtTime parses GeneratedAt, returning the zero time when it is
+// missing or malformed.
+func (m ArtifactMetadata) GeneratedAtTime() time.Time {
+	return parseTimestamp(m.GeneratedAt)
+}
+
+// CopyArtifact copies the core artifact name (e.g. "manifest.json") and its
+// metadata from one Artifacts to another. It reports whether from held it.
+func CopyArtifact(to, from *Artifacts, name string) bool {
+	for _, core := range coreArtifacts {
+		if core.name != name || len(*core.field(from)) == 0 {
+			continue
+		}
+		*core.field(to) = *core.field(from)
+		if to.Metadata == nil {
+			to.Metadata = map[string]ArtifactMetadata{}
+		}
+		metadata := from.Metadata[name]
+		to.Metadata[name] = metadata
+		if to.InvocationId == "" {
+			to.InvocationId = metadata.InvocationId
+		}
+		return true
+	}
+	return false
 }
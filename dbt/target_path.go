@@ -9,6 +9,23 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// ResolveProjectDir determines the dbt project directory the same way dbt
+// does:
+//  1. --project-dir from dbt CLI args (only in wrap mode)
+//  2. DBT_PROJECT_DIR env var
+//  3. "." (current directory)
+func ResolveProjectDir(dbtArgs []string) string {
+	if dir := parseFlagFromArgs(dbtArgs, "--project-dir"); dir != "" {
+		return dir
+	}
+
+	if dir, ok := os.LookupEnv("DBT_PROJECT_DIR"); ok && dir != "" {
+		return dir
+	}
+
+	return "."
+}
+
 // ResolveTargetDir determines the dbt target directory by checking multiple sources
 // in priority order:
 //  1. SYNQ_TARGET_DIR env var (explicit SYNQ override)
@@ -16,39 +33,69 @@ import (
 //  3. DBT_TARGET_PATH env var (dbt's own env var)
 //  4. target-path in dbt_project.yml (legacy dbt config)
 //  5. "target" (dbt default)
+//
+// Like dbt, relative paths from 2-5 are interpreted against the project
+// directory (see ResolveProjectDir). SYNQ_TARGET_DIR is used as given.
 func ResolveTargetDir(dbtArgs []string) string {
 	if dir, ok := os.LookupEnv("SYNQ_TARGET_DIR"); ok {
-		logrus.Infof("synq-dbt using target directory from SYNQ_TARGET_DIR: %s", dir)
+		logTargetDir(dir, "SYNQ_TARGET_DIR")
 		return dir
 	}
 
+	projectDir := ResolveProjectDir(dbtArgs)
+
 	if dir := parseTargetPathFromArgs(dbtArgs); dir != "" {
-		logrus.Infof("synq-dbt using target directory from --target-path flag: %s", dir)
+		dir = inProjectDir(projectDir, dir)
+		logTargetDir(dir, "--target-path")
 		return dir
 	}
 
 	if dir, ok := os.LookupEnv("DBT_TARGET_PATH"); ok {
-		logrus.Infof("synq-dbt using target directory from DBT_TARGET_PATH: %s", dir)
+		dir = inProjectDir(projectDir, dir)
+		logTargetDir(dir, "DBT_TARGET_PATH")
 		return dir
 	}
 
-	if dir := readTargetPathFromProject("dbt_project.yml"); dir != "" {
-		logrus.Infof("synq-dbt using target directory from dbt_project.yml: %s", dir)
+	if dir := readTargetPathFromProject(filepath.Join(projectDir, "dbt_project.yml")); dir != "" {
+		dir = inProjectDir(projectDir, dir)
+		logTargetDir(dir, "dbt_project.yml")
 		return dir
 	}
 
-	return "target"
+	dir := inProjectDir(projectDir, "target")
+	logTargetDir(dir, "default")
+	return dir
+}
+
+func logTargetDir(dir, source string) {
+	logrus.WithFields(logrus.Fields{
+		"target_dir": dir,
+		"source":     source,
+	}).Info("synq-dbt resolved target directory")
+}
+
+// inProjectDir resolves a relative path against the project directory.
+func inProjectDir(projectDir, dir string) string {
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(projectDir, dir)
 }
 
 // parseTargetPathFromArgs extracts the --target-path value from dbt CLI arguments.
 func parseTargetPathFromArgs(args []string) string {
+	return parseFlagFromArgs(args, "--target-path")
+}
+
+// parseFlagFromArgs extracts the value of a dbt CLI flag given either as
+// `--flag value` or `--flag=value`.
+func parseFlagFromArgs(args []string, flag string) string {
 	for i, arg := range args {
-		if arg == "--target-path" && i+1 < len(args) {
+		if arg == flag && i+1 < len(args) {
 			return args[i+1]
 		}
-		// Handle --target-path=value form
-		if strings.HasPrefix(arg, "--target-path=") {
-			return strings.TrimPrefix(arg, "--target-path=")
+		if strings.HasPrefix(arg, flag+"=") {
+			return strings.TrimPrefix(arg, flag+"=")
 		}
 	}
 	return ""
@@ -79,6 +79,7 @@ func TestResolveTargetDir_Priority(t *testing.T) {
 	// Clean env
 	os.Unsetenv("SYNQ_TARGET_DIR")
 	os.Unsetenv("DBT_TARGET_PATH")
+	os.Unsetenv("DBT_PROJECT_DIR")
 
 	// Test: default falls through to yaml
 	got := ResolveTargetDir(nil)
@@ -117,9 +118,66 @@ func TestResolveTargetDir_Default(t *testing.T) {
 
 	os.Unsetenv("SYNQ_TARGET_DIR")
 	os.Unsetenv("DBT_TARGET_PATH")
+	os.Unsetenv("DBT_PROJECT_DIR")
 
 	got := ResolveTargetDir(nil)
 	if got != "target" {
 		t.Errorf("expected 'target' default, got %q", got)
 	}
 }
+
+func TestResolveProjectDir(t *testing.T) {
+	t.Setenv("DBT_PROJECT_DIR", "")
+
+	if got := ResolveProjectDir(nil); got != "." {
+		t.Errorf("expected '.' default, got %q", got)
+	}
+
+	t.Setenv("DBT_PROJECT_DIR", "from_env")
+	if got := ResolveProjectDir(nil); got != "from_env" {
+		t.Errorf("expected 'from_env', got %q", got)
+	}
+
+	if got := ResolveProjectDir([]string{"run", "--project-dir", "from_flag"}); got != "from_flag" {
+		t.Errorf("expected 'from_flag', got %q", got)
+	}
+	if got := ResolveProjectDir([]string{"run", "--project-dir=from_flag"}); got != "from_flag" {
+		t.Errorf("expected 'from_flag', got %q", got)
+	}
+}
+
+func TestResolveTargetDir_ProjectDir(t *testing.T) {
+	projectDir := t.TempDir()
+	os.WriteFile(filepath.Join(projectDir, "dbt_project.yml"), []byte("target-path: from_yaml\n"), 0644)
+
+	t.Setenv("SYNQ_TARGET_DIR", "")
+	os.Unsetenv("SYNQ_TARGET_DIR")
+	t.Setenv("DBT_TARGET_PATH", "")
+	os.Unsetenv("DBT_TARGET_PATH")
+	t.Setenv("DBT_PROJECT_DIR", projectDir)
+
+	// dbt_project.yml is read from the project directory and its relative
+	// target-path is resolved against it.
+	if got, want := ResolveTargetDir(nil), filepath.Join(projectDir, "from_yaml"); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// --project-dir wins over DBT_PROJECT_DIR.
+	other := t.TempDir()
+	if got, want := ResolveTargetDir([]string{"run", "--project-dir", other}), filepath.Join(other, "target"); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// Relative --target-path is relative to the project, absolute is kept.
+	if got, want := ResolveTargetDir([]string{"run", "--target-path", "out"}), filepath.Join(projectDir, "out"); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got := ResolveTargetDir([]string{"run", "--target-path", "/abs/out"}); got != "/abs/out" {
+		t.Errorf("expected '/abs/out', got %q", got)
+	}
+
+	t.Setenv("DBT_TARGET_PATH", "env_out")
+	if got, want := ResolveTargetDir(nil), filepath.Join(projectDir, "env_out"); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
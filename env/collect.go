@@ -0,0 +1,213 @@
+// Package env decides which environment variables of the run are sent to
+// SYNQ and recognises the orchestrator and the Kubernetes pod synq-dbt runs
+// in.
+package env
+
+import (
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MaskedValue replaces the value of variables that look like secrets.
+const MaskedValue = "****"
+
+// DefaultMaxValueSize is the default limit of a single collected value.
+const DefaultMaxValueSize = 1024
+
+// secretPatterns match variable names whose values are never sent. They are
+// matched case-insensitively and don't need a separator, so bare names such
+// as PGPASSWORD, TOKEN or APIKEY are caught too. DBT_ENV_SECRET_* is dbt's
+// own convention for secrets it keeps out of logs and artifacts.
+var secretPatterns = []string{
+	"*PASSWORD*",
+	"*PASSWD*",
+	"*PASSPHRASE*",
+	"*_PASS",
+	"*TOKEN*",
+	"*SECRET*",
+	"*KEY",
+	"*PRIVATE_KEY*",
+	"*CREDENTIALS*",
+	"*CREDS",
+	"*JWT*",
+	"DBT_ENV_SECRET_*",
+}
+
+// notSecretNames are collected orchestrator variables caught by
+// secretPatterns that name a step, not a key.
+var notSecretNames = []string{"DAGSTER_STEP_KEY", "BUILDKITE_STEP_KEY"}
+
+// urlUserInfo matches the user info of URLs within a value, e.g.
+// "user:password@" in "postgres://user:password@db:5432/analytics".
+var urlUserInfo = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/?#@\s]+@`)
+
+// Options configures Collect.
+type Options struct {
+	// Allow lists names or glob patterns (e.g. "DAGSTER_*") of variables
+	// to collect.
+	Allow []string
+	// Deny lists names or patterns never collected, even when allowed.
+	Deny []string
+	// MaxValueSize truncates longer values, 0 means no limit.
+	MaxValueSize int
+}
+
+// OptionsFromEnv extends allow, the variables collected by default, with
+// the comma-separated patterns of SYNQ_ENV_ALLOW, and reads SYNQ_ENV_DENY
+// and SYNQ_ENV_MAX_VALUE_SIZE.
+func OptionsFromEnv(allow []string) Options {
+	options := Options{
+		Allow:        append(append([]string(nil), allow...), splitList(os.Getenv("SYNQ_ENV_ALLOW"))...),
+		Deny:         splitList(os.Getenv("SYNQ_ENV_DENY")),
+		MaxValueSize: DefaultMaxValueSize,
+	}
+	if value := strings.TrimSpace(os.Getenv("SYNQ_ENV_MAX_VALUE_SIZE")); value != "" {
+		if size, err := strconv.Atoi(value); err == nil && size >= 0 {
+			options.MaxValueSize = size
+		} else {
+			logrus.Warnf("ignoring SYNQ_ENV_MAX_VALUE_SIZE=%q (must be a number of bytes, 0 for no limit)", value)
+		}
+	}
+	return options
+}
+
+// Collect picks the allowed variables out of environ, a list of KEY=VALUE
+// entries as returned by os.Environ. Values of variables named like secrets
+// are masked, credentials in URLs are removed, see scrubValue, and long
+// values are truncated.
+func Collect(environ []string, options Options) map[string]string {
+	collected := map[string]string{}
+	for _, entry := range environ {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || value == "" || !Matches(name, options.Allow) || Matches(name, options.Deny) {
+			continue
+		}
+		if IsSecret(name) {
+			collected[name] = MaskedValue
+			continue
+		}
+		value = scrubValue(value)
+		if options.MaxValueSize > 0 && len(value) > options.MaxValueSize {
+			value = truncate(value, options.MaxValueSize)
+		}
+		collected[name] = value
+	}
+	return collected
+}
+
+// Matches reports whether name matches any of the glob patterns.
+func Matches(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSecret reports whether name looks like it holds a credential. It also
+// takes Kubernetes label and annotation names, whose prefix ends in "/".
+func IsSecret(name string) bool {
+	name = strings.ToUpper(strings.ReplaceAll(name, "/", "_"))
+	return Matches(name, secretPatterns) && !Matches(name, notSecretNames)
+}
+
+// scrubEntries returns values with the values of secret names masked and
+// credentials removed from the rest, like Collect does for variables.
+func scrubEntries(values map[string]string) map[string]string {
+	scrubbed := make(map[string]string, len(values))
+	for name, value := range values {
+		if IsSecret(name) {
+			scrubbed[name] = MaskedValue
+			continue
+		}
+		scrubbed[name] = scrubValue(value)
+	}
+	return scrubbed
+}
+
+// ScrubUserInfo removes the user info, often a password or token, from
+// every URL in value.
+func ScrubUserInfo(value string) string {
+	if !strings.Contains(value, "@") {
+		return value
+	}
+	return urlUserInfo.ReplaceAllString(value, "$1")
+}
+
+// urlQuery matches the query of URLs within a value, up to the fragment or
+// the end of the URL.
+var urlQuery = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://[^\s?#]*)\?([^\s#]*)`)
+
+// credentialParams are substrings of query parameter names that carry
+// credentials, matched case-insensitively, e.g. "private_token", "sig" or
+// "X-Amz-Signature".
+var credentialParams = []string{"token", "sig", "key", "password", "passwd", "secret", "credential", "auth"}
+
+// scrubValue removes credentials from the URLs in value: their user info
+// and query parameters named like credentials. Everything else, scheme,
+// path, trailing slash, other parameters and fragment, is kept, so links
+// back to a run still work.
+func scrubValue(value string) string {
+	value = ScrubUserInfo(value)
+	if !strings.Contains(value, "?") {
+		return value
+	}
+	return urlQuery.ReplaceAllStringFunc(value, func(match string) string {
+		parts := urlQuery.FindStringSubmatch(match)
+		var kept []string
+		for _, param := range strings.Split(parts[2], "&") {
+			name, _, _ := strings.Cut(param, "=")
+			if name, err := url.QueryUnescape(name); err == nil && isCredentialParam(name) {
+				continue
+			}
+			kept = append(kept, param)
+		}
+		if len(kept) == 0 {
+			return parts[1]
+		}
+		return parts[1] + "?" + strings.Join(kept, "&")
+	})
+}
+
+func isCredentialParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, credential := range credentialParams {
+		if strings.Contains(name, credential) {
+			return true
+		}
+	}
+	return false
+}
+
+const truncatedSuffix = "...(truncated)"
+
+// truncate shortens value to at most size bytes, marker included, without
+// splitting a UTF-8 sequence.
+func truncate(value string, size int) string {
+	keep := size - len(truncatedSuffix)
+	if keep <= 0 {
+		return truncatedSuffix[:size]
+	}
+	for keep > 0 && !utf8.RuneStart(value[keep]) {
+		keep--
+	}
+	return value[:keep] + truncatedSuffix
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,223 @@
+package env
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Keys of the pod metadata in the uploaded environment.
+const (
+	KubernetesNamespaceKey      = "SYNQ_K8S_NAMESPACE"
+	KubernetesPodNameKey        = "SYNQ_K8S_POD_NAME"
+	KubernetesPodUidKey         = "SYNQ_K8S_POD_UID"
+	KubernetesNodeNameKey       = "SYNQ_K8S_NODE_NAME"
+	KubernetesContainerNameKey  = "SYNQ_K8S_CONTAINER_NAME"
+	KubernetesContainerImageKey = "SYNQ_K8S_CONTAINER_IMAGE"
+	KubernetesContainerIdKey    = "SYNQ_K8S_CONTAINER_ID"
+	KubernetesLabelsKey         = "SYNQ_K8S_LABELS"
+	KubernetesAnnotationsKey    = "SYNQ_K8S_ANNOTATIONS"
+)
+
+const (
+	serviceAccountNamespaceFile = "var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	cgroupFile                  = "proc/self/cgroup"
+	defaultPodInfoDir           = "etc/podinfo"
+)
+
+// ignoredAnnotations are too large or too noisy to be worth uploading.
+var ignoredAnnotations = map[string]bool{
+	"kubectl.kubernetes.io/last-applied-configuration": true,
+}
+
+// KubernetesContext describes the pod synq-dbt runs in.
+type KubernetesContext struct {
+	Namespace      string
+	PodName        string
+	PodUid         string
+	NodeName       string
+	ContainerName  string
+	ContainerImage string
+	ContainerId    string
+	Labels         map[string]string
+	Annotations    map[string]string
+}
+
+// Metadata returns the non-empty fields under the SYNQ_K8S_* keys. Labels
+// and annotations are JSON objects, masked and scrubbed of credentials like
+// collected variables, e.g. for Vault agent annotations; when one is longer
+// than maxValueSize bytes (0 for no limit), its largest entries are left out
+// until it fits.
+func (c *KubernetesContext) Metadata(maxValueSize int) map[string]string {
+	metadata := map[string]string{}
+	for key, value := range map[string]string{
+		KubernetesNamespaceKey:      c.Namespace,
+		KubernetesPodNameKey:        c.PodName,
+		KubernetesPodUidKey:         c.PodUid,
+		KubernetesNodeNameKey:       c.NodeName,
+		KubernetesContainerNameKey:  c.ContainerName,
+		KubernetesContainerImageKey: c.ContainerImage,
+		KubernetesContainerIdKey:    c.ContainerId,
+	} {
+		if value != "" {
+			if maxValueSize > 0 && len(value) > maxValueSize {
+				value = truncate(value, maxValueSize)
+			}
+			metadata[key] = value
+		}
+	}
+	if labels := encodeCapped(scrubEntries(c.Labels), maxValueSize); labels != "" {
+		metadata[KubernetesLabelsKey] = labels
+	}
+	annotations := make(map[string]string, len(c.Annotations))
+	for name, value := range c.Annotations {
+		if !ignoredAnnotations[name] {
+			annotations[name] = value
+		}
+	}
+	if encoded := encodeCapped(scrubEntries(annotations), maxValueSize); encoded != "" {
+		metadata[KubernetesAnnotationsKey] = encoded
+	}
+	return metadata
+}
+
+// encodeCapped encodes values as a JSON object of at most maxSize bytes,
+// dropping the largest entries first. Returns "" when nothing is left.
+// values is modified.
+func encodeCapped(values map[string]string, maxSize int) string {
+	for len(values) > 0 {
+		encoded, _ := json.Marshal(values)
+		if maxSize <= 0 || len(encoded) <= maxSize {
+			return string(encoded)
+		}
+		largest := ""
+		for name, value := range values {
+			if largest == "" || len(name)+len(value) > len(largest)+len(values[largest]) {
+				largest = name
+			}
+		}
+		delete(values, largest)
+	}
+	return ""
+}
+
+// DetectKubernetes returns the metadata of the pod synq-dbt runs in, or nil
+// outside Kubernetes. It is read from, in order of preference:
+//   - downward-API environment variables (POD_NAME, POD_NAMESPACE,
+//     NODE_NAME, POD_UID, CONTAINER_NAME, CONTAINER_IMAGE, each optionally
+//     prefixed with K8S_ or MY_)
+//   - the service account's namespace file
+//   - the hostname, which is the pod name unless overridden in the pod spec
+//   - /proc/self/cgroup for the pod UID and container id
+//   - a downward-API volume with "labels" and "annotations" files, mounted
+//     at /etc/podinfo or SYNQ_K8S_PODINFO_DIR
+func DetectKubernetes() *KubernetesContext {
+	hostname, _ := os.Hostname()
+	return detectKubernetes(os.Getenv, os.DirFS("/"), hostname)
+}
+
+func detectKubernetes(getenv func(string) string, root fs.FS, hostname string) *KubernetesContext {
+	if getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return nil
+	}
+
+	c := &KubernetesContext{
+		Namespace:      downwardEnv(getenv, "POD_NAMESPACE", "NAMESPACE"),
+		PodName:        downwardEnv(getenv, "POD_NAME"),
+		PodUid:         downwardEnv(getenv, "POD_UID"),
+		NodeName:       downwardEnv(getenv, "NODE_NAME"),
+		ContainerName:  downwardEnv(getenv, "CONTAINER_NAME"),
+		ContainerImage: downwardEnv(getenv, "CONTAINER_IMAGE"),
+	}
+	if c.Namespace == "" {
+		if namespace, err := fs.ReadFile(root, serviceAccountNamespaceFile); err == nil {
+			c.Namespace = strings.TrimSpace(string(namespace))
+		}
+	}
+	if c.PodName == "" {
+		c.PodName = hostname
+	}
+	if cgroup, err := fs.ReadFile(root, cgroupFile); err == nil {
+		podUid, containerId := parseCgroup(cgroup)
+		if c.PodUid == "" {
+			c.PodUid = podUid
+		}
+		c.ContainerId = containerId
+	}
+
+	podInfoDir := defaultPodInfoDir
+	if dir := getenv("SYNQ_K8S_PODINFO_DIR"); dir != "" {
+		podInfoDir = strings.TrimPrefix(path.Clean(dir), "/")
+	}
+	c.Labels = readPodInfo(root, path.Join(podInfoDir, "labels"))
+	c.Annotations = readPodInfo(root, path.Join(podInfoDir, "annotations"))
+
+	return c
+}
+
+func downwardEnv(getenv func(string) string, names ...string) string {
+	for _, name := range names {
+		for _, prefix := range []string{"K8S_", "", "MY_"} {
+			if value := strings.TrimSpace(getenv(prefix + name)); value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+var (
+	// cgroupPodUid matches the pod part of both cgroup layouts:
+	// ".../kubepods/burstable/pod<uid>/..." (cgroupfs driver) and
+	// ".../kubepods-burstable-pod<uid with _>.slice/..." (systemd driver).
+	cgroupPodUid = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+	// cgroupContainerId matches the 64 hex digit id of the last path
+	// element, e.g. "cri-containerd-<id>.scope", "docker-<id>.scope" or
+	// just "<id>".
+	cgroupContainerId = regexp.MustCompile(`([0-9a-f]{64})(\.scope)?$`)
+)
+
+func parseCgroup(cgroup []byte) (podUid, containerId string) {
+	scanner := bufio.NewScanner(bytes.NewReader(cgroup))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.Contains(line, "kubepods") {
+			continue
+		}
+		if match := cgroupPodUid.FindStringSubmatch(line); match != nil && podUid == "" {
+			podUid = strings.ReplaceAll(match[1], "_", "-")
+		}
+		if match := cgroupContainerId.FindStringSubmatch(line); match != nil && containerId == "" {
+			containerId = match[1]
+		}
+	}
+	return podUid, containerId
+}
+
+// readPodInfo parses a downward-API labels or annotations file, which holds
+// one key="quoted value" per line.
+func readPodInfo(root fs.FS, name string) map[string]string {
+	content, err := fs.ReadFile(root, name)
+	if err != nil {
+		return nil
+	}
+	values := map[string]string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		key, quoted, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || key == "" {
+			continue
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			value = quoted
+		}
+		values[key] = value
+	}
+	return values
+}
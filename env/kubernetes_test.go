@@ -0,0 +1,140 @@
+package env
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const (
+	testPodUid      = "0c4d56b8-2a6e-4c1e-9f0e-6d1d2f3a4b5c"
+	testContainerId = "3f9b1c2d4e5f60718293a4b5c6d7e8f90112233445566778899aabbccddeeff0"
+)
+
+func TestDetectKubernetes(t *testing.T) {
+	root := fstest.MapFS{
+		serviceAccountNamespaceFile: {Data: []byte("data-platform\n")},
+		cgroupFile: {Data: []byte(
+			"12:memory:/kubepods/burstable/pod" + testPodUid + "/" + testContainerId + "\n" +
+				"0::/\n",
+		)},
+		"etc/podinfo/labels": {Data: []byte(
+			"app=\"dbt\"\n" +
+				"airflow-worker=\"nightly\"\n",
+		)},
+		"etc/podinfo/annotations": {Data: []byte(
+			"note=\"line \\\"one\\\"\"\n" +
+				"kubectl.kubernetes.io/last-applied-configuration=\"{}\"\n",
+		)},
+	}
+	env := map[string]string{
+		"KUBERNETES_SERVICE_HOST": "10.0.0.1",
+		"MY_NODE_NAME":            "node-a",
+		"CONTAINER_IMAGE":         "ghcr.io/acme/dbt:1.8",
+	}
+
+	got := detectKubernetes(func(name string) string { return env[name] }, root, "dbt-run-x7k2p")
+	want := &KubernetesContext{
+		Namespace:      "data-platform",
+		PodName:        "dbt-run-x7k2p",
+		PodUid:         testPodUid,
+		NodeName:       "node-a",
+		ContainerImage: "ghcr.io/acme/dbt:1.8",
+		ContainerId:    testContainerId,
+		Labels:         map[string]string{"app": "dbt", "airflow-worker": "nightly"},
+		Annotations: map[string]string{
+			"note": `line "one"`,
+			"kubectl.kubernetes.io/last-applied-configuration": "{}",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("detectKubernetes() = %+v, want %+v", got, want)
+	}
+
+	metadata := got.Metadata(0)
+	if metadata[KubernetesLabelsKey] != `{"airflow-worker":"nightly","app":"dbt"}` {
+		t.Errorf("labels = %s", metadata[KubernetesLabelsKey])
+	}
+	if metadata[KubernetesAnnotationsKey] != `{"note":"line \"one\""}` {
+		t.Errorf("annotations = %s", metadata[KubernetesAnnotationsKey])
+	}
+	if _, ok := metadata[KubernetesContainerNameKey]; ok {
+		t.Errorf("empty fields must be left out")
+	}
+}
+
+func TestKubernetesContext_MetadataSizeCap(t *testing.T) {
+	c := &KubernetesContext{
+		PodName:     "dbt-" + strings.Repeat("x", 100),
+		Labels:      map[string]string{"app": "dbt", "blob": strings.Repeat("y", 100)},
+		Annotations: map[string]string{"huge": strings.Repeat("z", 100)},
+	}
+
+	metadata := c.Metadata(64)
+	if got := metadata[KubernetesLabelsKey]; got != `{"app":"dbt"}` {
+		t.Errorf("labels = %s, want the large entry left out", got)
+	}
+	if _, ok := metadata[KubernetesAnnotationsKey]; ok {
+		t.Errorf("annotations should be left out, got %s", metadata[KubernetesAnnotationsKey])
+	}
+	if got := metadata[KubernetesPodNameKey]; len(got) > 64 {
+		t.Errorf("pod name not truncated: %d bytes", len(got))
+	}
+}
+
+func TestKubernetesContext_MetadataMasksSecrets(t *testing.T) {
+	c := &KubernetesContext{
+		Labels: map[string]string{"app": "dbt", "api-token": "abc"},
+		Annotations: map[string]string{
+			"vault.hashicorp.com/agent-inject-secret-db": "database/creds/dbt",
+			"sidecar.example.com/upstream":               "postgres://dbt:hunter2@db:5432/analytics?password=x&sslmode=require",
+			"team":                                       "analytics",
+		},
+	}
+
+	metadata := c.Metadata(0)
+	if got, want := metadata[KubernetesLabelsKey], `{"api-token":"****","app":"dbt"}`; got != want {
+		t.Errorf("labels = %s, want %s", got, want)
+	}
+	want := `{"sidecar.example.com/upstream":"postgres://db:5432/analytics?sslmode=require","team":"analytics","vault.hashicorp.com/agent-inject-secret-db":"****"}`
+	if got := metadata[KubernetesAnnotationsKey]; got != want {
+		t.Errorf("annotations = %s, want %s", got, want)
+	}
+}
+
+func TestDetectKubernetes_OutsideKubernetes(t *testing.T) {
+	if got := detectKubernetes(func(string) string { return "" }, fstest.MapFS{}, "laptop"); got != nil {
+		t.Errorf("expected nil outside Kubernetes, got %+v", got)
+	}
+}
+
+func TestParseCgroup(t *testing.T) {
+	tests := map[string]struct {
+		cgroup      string
+		podUid      string
+		containerId string
+	}{
+		"cgroupfs": {
+			cgroup:      "1:name=systemd:/kubepods/besteffort/pod" + testPodUid + "/" + testContainerId,
+			podUid:      testPodUid,
+			containerId: testContainerId,
+		},
+		"systemd": {
+			cgroup:      "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0c4d56b8_2a6e_4c1e_9f0e_6d1d2f3a4b5c.slice/cri-containerd-" + testContainerId + ".scope",
+			podUid:      testPodUid,
+			containerId: testContainerId,
+		},
+		"cgroup v2 namespace": {
+			cgroup: "0::/",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			podUid, containerId := parseCgroup([]byte(tt.cgroup))
+			if podUid != tt.podUid || containerId != tt.containerId {
+				t.Errorf("parseCgroup() = %q, %q, want %q, %q", podUid, containerId, tt.podUid, tt.containerId)
+			}
+		})
+	}
+}
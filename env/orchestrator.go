@@ -0,0 +1,328 @@
+package env
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Keys of the normalized run context in the uploaded environment.
+const (
+	OrchestratorKey         = "SYNQ_ORCHESTRATOR"
+	OrchestratorPipelineKey = "SYNQ_ORCHESTRATOR_PIPELINE"
+	OrchestratorTaskKey     = "SYNQ_ORCHESTRATOR_TASK"
+	OrchestratorRunIdKey    = "SYNQ_ORCHESTRATOR_RUN_ID"
+	OrchestratorAttemptKey  = "SYNQ_ORCHESTRATOR_ATTEMPT"
+	OrchestratorUrlKey      = "SYNQ_ORCHESTRATOR_URL"
+)
+
+// RunContext describes the orchestrator run synq-dbt is part of, the same
+// way for every orchestrator.
+type RunContext struct {
+	// Orchestrator is e.g. "airflow" or "github_actions".
+	Orchestrator string
+	// Pipeline is the DAG, job, flow or workflow.
+	Pipeline string
+	// Task is the task, step or job within the pipeline.
+	Task string
+	// RunId identifies the pipeline run.
+	RunId string
+	// Attempt counts retries of the task or run, starting at 1.
+	Attempt string
+	// Url links back to the run in the orchestrator's UI.
+	Url string
+	// Env lists the orchestrator's own variables collected alongside the
+	// normalized fields. They are named one by one: CI systems keep tokens
+	// in variables like CI_REPOSITORY_URL or CI_JOB_JWT_V2, which a pattern
+	// such as "CI_*" would pick up.
+	Env []string
+}
+
+// Metadata returns the non-empty fields under the SYNQ_ORCHESTRATOR* keys.
+func (c *RunContext) Metadata() map[string]string {
+	metadata := map[string]string{}
+	for key, value := range map[string]string{
+		OrchestratorKey:         c.Orchestrator,
+		OrchestratorPipelineKey: c.Pipeline,
+		OrchestratorTaskKey:     c.Task,
+		OrchestratorRunIdKey:    c.RunId,
+		OrchestratorAttemptKey:  c.Attempt,
+		OrchestratorUrlKey:      scrubValue(c.Url),
+	} {
+		if value != "" {
+			metadata[key] = value
+		}
+	}
+	return metadata
+}
+
+type orchestrator struct {
+	name string
+	// detected reports whether the run happens in this orchestrator.
+	detected func(getenv func(string) string) bool
+	env      []string
+	context  func(getenv func(string) string) RunContext
+}
+
+// present returns a detector checking that all variables are set.
+func present(names ...string) func(getenv func(string) string) bool {
+	return func(getenv func(string) string) bool {
+		for _, name := range names {
+			if getenv(name) == "" {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// orchestrators are tried in order. Workflow orchestrators come before CI
+// systems, which may well be what runs the orchestrator's worker.
+var orchestrators = []orchestrator{
+	{
+		name:     "airflow",
+		detected: present("AIRFLOW_CTX_DAG_ID"),
+		env: []string{
+			"AIRFLOW_CTX_DAG_OWNER", "AIRFLOW_CTX_DAG_ID", "AIRFLOW_CTX_TASK_ID", "AIRFLOW_CTX_EXECUTION_DATE",
+			"AIRFLOW_CTX_LOGICAL_DATE", "AIRFLOW_CTX_TRY_NUMBER", "AIRFLOW_CTX_DAG_RUN_ID",
+		},
+		context: func(getenv func(string) string) RunContext {
+			context := RunContext{
+				Pipeline: getenv("AIRFLOW_CTX_DAG_ID"),
+				Task:     getenv("AIRFLOW_CTX_TASK_ID"),
+				RunId:    getenv("AIRFLOW_CTX_DAG_RUN_ID"),
+				Attempt:  getenv("AIRFLOW_CTX_TRY_NUMBER"),
+			}
+			if base := getenv("AIRFLOW__WEBSERVER__BASE_URL"); base != "" && context.RunId != "" {
+				context.Url = strings.TrimSuffix(base, "/") + "/dags/" + url.PathEscape(context.Pipeline) +
+					"/grid?dag_run_id=" + url.QueryEscape(context.RunId)
+				if context.Task != "" {
+					context.Url += "&task_id=" + url.QueryEscape(context.Task)
+				}
+			}
+			return context
+		},
+	},
+	{
+		name:     "dagster",
+		detected: present("DAGSTER_RUN_ID"),
+		env: []string{
+			"DAGSTER_RUN_ID", "DAGSTER_JOB_NAME", "DAGSTER_PIPELINE_NAME", "DAGSTER_STEP_KEY",
+			"DAGSTER_CLOUD_DEPLOYMENT_NAME",
+		},
+		context: func(getenv func(string) string) RunContext {
+			context := RunContext{
+				Pipeline: first(getenv, "DAGSTER_JOB_NAME", "DAGSTER_PIPELINE_NAME"),
+				Task:     getenv("DAGSTER_STEP_KEY"),
+				RunId:    getenv("DAGSTER_RUN_ID"),
+			}
+			if base := first(getenv, "DAGSTER_WEBSERVER_URL", "DAGSTER_CLOUD_URL"); base != "" {
+				context.Url = strings.TrimSuffix(base, "/") + "/runs/" + url.PathEscape(context.RunId)
+			}
+			return context
+		},
+	},
+	{
+		name:     "prefect",
+		detected: present("PREFECT__FLOW_RUN_ID"),
+		env: []string{
+			"PREFECT__FLOW_RUN_ID", "PREFECT__FLOW_ID", "PREFECT__FLOW_NAME", "PREFECT__TASK_RUN_ID",
+			"PREFECT__TASK_RUN_NAME", "PREFECT_UI_URL",
+		},
+		context: func(getenv func(string) string) RunContext {
+			context := RunContext{
+				Pipeline: getenv("PREFECT__FLOW_NAME"),
+				Task:     getenv("PREFECT__TASK_RUN_NAME"),
+				RunId:    getenv("PREFECT__FLOW_RUN_ID"),
+			}
+			if base := getenv("PREFECT_UI_URL"); base != "" {
+				context.Url = strings.TrimSuffix(base, "/") + "/runs/flow-run/" + url.PathEscape(context.RunId)
+			}
+			return context
+		},
+	},
+	{
+		name:     "argo_workflows",
+		detected: present("ARGO_WORKFLOW_NAME"),
+		env: []string{
+			"ARGO_WORKFLOW_NAME", "ARGO_WORKFLOW_NAMESPACE", "ARGO_WORKFLOW_UID", "ARGO_NODE_ID",
+			"ARGO_POD_NAME", "ARGO_RETRY_COUNT",
+		},
+		context: func(getenv func(string) string) RunContext {
+			context := RunContext{
+				Pipeline: getenv("ARGO_WORKFLOW_NAME"),
+				Task:     argoTemplateName(getenv("ARGO_TEMPLATE")),
+				RunId:    first(getenv, "ARGO_WORKFLOW_UID", "ARGO_WORKFLOW_NAME"),
+				Attempt:  attemptFromRetries(getenv("ARGO_RETRY_COUNT")),
+			}
+			if base := getenv("ARGO_SERVER_URL"); base != "" {
+				context.Url = strings.TrimSuffix(base, "/") + "/workflows/" +
+					url.PathEscape(getenv("ARGO_WORKFLOW_NAMESPACE")) + "/" + url.PathEscape(context.Pipeline)
+			}
+			return context
+		},
+	},
+	{
+		name:     "kestra",
+		detected: present("KESTRA_EXECUTION_ID"),
+		env: []string{
+			"KESTRA_EXECUTION_ID", "KESTRA_NAMESPACE", "KESTRA_FLOW_ID", "KESTRA_TASK_ID", "KESTRA_ATTEMPT", "KESTRA_URL",
+		},
+		context: func(getenv func(string) string) RunContext {
+			pipeline := getenv("KESTRA_FLOW_ID")
+			if namespace := getenv("KESTRA_NAMESPACE"); namespace != "" && pipeline != "" {
+				pipeline = namespace + "." + pipeline
+			}
+			context := RunContext{
+				Pipeline: pipeline,
+				Task:     getenv("KESTRA_TASK_ID"),
+				RunId:    getenv("KESTRA_EXECUTION_ID"),
+				Attempt:  getenv("KESTRA_ATTEMPT"),
+			}
+			if base := getenv("KESTRA_URL"); base != "" {
+				context.Url = strings.TrimSuffix(base, "/") + "/ui/executions/" +
+					url.PathEscape(getenv("KESTRA_NAMESPACE")) + "/" + url.PathEscape(getenv("KESTRA_FLOW_ID")) + "/" +
+					url.PathEscape(context.RunId)
+			}
+			return context
+		},
+	},
+	{
+		name:     "mage",
+		detected: present("MAGE_PIPELINE_UUID"),
+		env:      []string{"MAGE_PIPELINE_UUID", "MAGE_BLOCK_UUID", "MAGE_PIPELINE_RUN_ID"},
+		context: func(getenv func(string) string) RunContext {
+			return RunContext{
+				Pipeline: getenv("MAGE_PIPELINE_UUID"),
+				Task:     getenv("MAGE_BLOCK_UUID"),
+				RunId:    getenv("MAGE_PIPELINE_RUN_ID"),
+			}
+		},
+	},
+	{
+		name:     "github_actions",
+		detected: func(getenv func(string) string) bool { return getenv("GITHUB_ACTIONS") == "true" },
+		env: []string{
+			"GITHUB_WORKFLOW", "GITHUB_JOB", "GITHUB_RUN_ID", "GITHUB_RUN_NUMBER", "GITHUB_RUN_ATTEMPT",
+			"GITHUB_REPOSITORY", "GITHUB_SERVER_URL", "GITHUB_EVENT_NAME", "GITHUB_REF", "GITHUB_REF_NAME",
+			"GITHUB_SHA", "GITHUB_HEAD_REF", "GITHUB_BASE_REF", "GITHUB_ACTOR", "RUNNER_NAME", "RUNNER_OS",
+		},
+		context: func(getenv func(string) string) RunContext {
+			context := RunContext{
+				Pipeline: getenv("GITHUB_WORKFLOW"),
+				Task:     getenv("GITHUB_JOB"),
+				RunId:    getenv("GITHUB_RUN_ID"),
+				Attempt:  getenv("GITHUB_RUN_ATTEMPT"),
+			}
+			if server, repository := getenv("GITHUB_SERVER_URL"), getenv("GITHUB_REPOSITORY"); server != "" && repository != "" && context.RunId != "" {
+				context.Url = strings.TrimSuffix(server, "/") + "/" + repository + "/actions/runs/" + context.RunId
+				if context.Attempt != "" {
+					context.Url += "/attempts/" + context.Attempt
+				}
+			}
+			return context
+		},
+	},
+	{
+		name:     "gitlab_ci",
+		detected: func(getenv func(string) string) bool { return getenv("GITLAB_CI") == "true" },
+		env: []string{
+			"CI_PIPELINE_ID", "CI_PIPELINE_IID", "CI_PIPELINE_NAME", "CI_PIPELINE_SOURCE", "CI_PIPELINE_URL",
+			"CI_JOB_ID", "CI_JOB_NAME", "CI_JOB_STAGE", "CI_JOB_URL", "CI_PROJECT_PATH", "CI_PROJECT_URL",
+			"CI_SERVER_URL", "CI_COMMIT_SHA", "CI_COMMIT_REF_NAME", "CI_COMMIT_BRANCH", "CI_COMMIT_TAG",
+			"CI_MERGE_REQUEST_IID", "CI_MERGE_REQUEST_TARGET_BRANCH_NAME", "GITLAB_USER_LOGIN",
+		},
+		context: func(getenv func(string) string) RunContext {
+			return RunContext{
+				Pipeline: first(getenv, "CI_PIPELINE_NAME", "CI_PROJECT_PATH"),
+				Task:     getenv("CI_JOB_NAME"),
+				RunId:    getenv("CI_PIPELINE_ID"),
+				Url:      first(getenv, "CI_JOB_URL", "CI_PIPELINE_URL"),
+			}
+		},
+	},
+	{
+		name:     "buildkite",
+		detected: func(getenv func(string) string) bool { return getenv("BUILDKITE") == "true" },
+		env: []string{
+			"BUILDKITE_ORGANIZATION_SLUG", "BUILDKITE_PIPELINE_SLUG", "BUILDKITE_BUILD_ID", "BUILDKITE_BUILD_NUMBER",
+			"BUILDKITE_BUILD_URL", "BUILDKITE_JOB_ID", "BUILDKITE_STEP_KEY", "BUILDKITE_LABEL",
+			"BUILDKITE_RETRY_COUNT", "BUILDKITE_BRANCH", "BUILDKITE_COMMIT", "BUILDKITE_PULL_REQUEST",
+		},
+		context: func(getenv func(string) string) RunContext {
+			return RunContext{
+				Pipeline: getenv("BUILDKITE_PIPELINE_SLUG"),
+				Task:     first(getenv, "BUILDKITE_STEP_KEY", "BUILDKITE_LABEL"),
+				RunId:    getenv("BUILDKITE_BUILD_ID"),
+				Attempt:  attemptFromRetries(getenv("BUILDKITE_RETRY_COUNT")),
+				Url:      getenv("BUILDKITE_BUILD_URL"),
+			}
+		},
+	},
+	{
+		name:     "jenkins",
+		detected: present("JENKINS_URL", "BUILD_NUMBER"),
+		env: []string{
+			"JENKINS_URL", "JOB_NAME", "JOB_BASE_NAME", "JOB_URL", "BUILD_NUMBER", "BUILD_ID", "BUILD_TAG",
+			"BUILD_URL", "STAGE_NAME", "NODE_NAME", "EXECUTOR_NUMBER",
+		},
+		context: func(getenv func(string) string) RunContext {
+			return RunContext{
+				Pipeline: getenv("JOB_NAME"),
+				Task:     getenv("STAGE_NAME"),
+				RunId:    first(getenv, "BUILD_TAG", "BUILD_NUMBER"),
+				Url:      getenv("BUILD_URL"),
+			}
+		},
+	},
+}
+
+// DetectOrchestrator recognises the orchestrator from its well-known
+// variables, or returns nil.
+func DetectOrchestrator() *RunContext {
+	return detectOrchestrator(os.Getenv)
+}
+
+func detectOrchestrator(getenv func(string) string) *RunContext {
+	for _, o := range orchestrators {
+		if !o.detected(getenv) {
+			continue
+		}
+		context := o.context(getenv)
+		context.Orchestrator = o.name
+		context.Env = o.env
+		return &context
+	}
+	return nil
+}
+
+func first(getenv func(string) string, names ...string) string {
+	for _, name := range names {
+		if value := getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// attemptFromRetries turns a 0-based retry count into a 1-based attempt.
+func attemptFromRetries(retries string) string {
+	if n, err := strconv.Atoi(retries); err == nil && n >= 0 {
+		return strconv.Itoa(n + 1)
+	}
+	return ""
+}
+
+// argoTemplateName extracts the name from ARGO_TEMPLATE, the JSON of the
+// template the pod runs.
+func argoTemplateName(template string) string {
+	var parsed struct {
+		Name string `json:"name"`
+	}
+	if template == "" || json.Unmarshal([]byte(template), &parsed) != nil {
+		return ""
+	}
+	return parsed.Name
+}
@@ -0,0 +1,230 @@
+package git
+
+import (
+	"strings"
+)
+
+// Variables which override what is detected, e.g. baked into an image at
+// build time, where the image has no .git.
+const (
+	ShaEnv    = "SYNQ_GIT_SHA"
+	BranchEnv = "SYNQ_GIT_BRANCH"
+	UrlEnv    = "SYNQ_GIT_URL"
+)
+
+// ciSystem reads the checkout of a CI system from its variables.
+type ciSystem struct {
+	name string
+	// marker is set by the CI system in every job.
+	marker string
+	read   func(getenv func(string) string) *Context
+	// baseRef returns the target of the pull or merge request, if any.
+	baseRef func(getenv func(string) string) string
+	// pullRequest returns the pull or merge request, or nil when the run
+	// is not for one.
+	pullRequest func(getenv func(string) string) *PullRequest
+}
+
+var ciSystems = []ciSystem{
+	{name: "github_actions", marker: "GITHUB_ACTIONS", read: func(getenv func(string) string) *Context {
+		c := &Context{CommitSha: getenv("GITHUB_SHA"), Branch: getenv("GITHUB_HEAD_REF")}
+		if c.Branch == "" && strings.HasPrefix(getenv("GITHUB_REF"), "refs/heads/") {
+			// GITHUB_REF_NAME is also set for tags, the branch is only
+			// known from the full ref.
+			c.Branch = strings.TrimPrefix(getenv("GITHUB_REF"), "refs/heads/")
+		}
+		if server, repository := getenv("GITHUB_SERVER_URL"), getenv("GITHUB_REPOSITORY"); server != "" && repository != "" {
+			c.CloneUrl = strings.TrimSuffix(server, "/") + "/" + repository + ".git"
+		}
+		return c
+	}, baseRef: func(getenv func(string) string) string {
+		return getenv("GITHUB_BASE_REF")
+	}, pullRequest: githubPullRequest},
+	{name: "gitlab_ci", marker: "GITLAB_CI", read: func(getenv func(string) string) *Context {
+		// CI_REPOSITORY_URL would carry the job token, the project URL
+		// doesn't.
+		return &Context{
+			CommitSha: getenv("CI_COMMIT_SHA"),
+			Branch:    firstEnv(getenv, "CI_MERGE_REQUEST_SOURCE_BRANCH_NAME", "CI_COMMIT_BRANCH"),
+			CloneUrl:  getenv("CI_PROJECT_URL"),
+		}
+	}, baseRef: func(getenv func(string) string) string {
+		return firstEnv(getenv, "CI_MERGE_REQUEST_DIFF_BASE_SHA", "CI_MERGE_REQUEST_TARGET_BRANCH_NAME")
+	}, pullRequest: func(getenv func(string) string) *PullRequest {
+		if getenv("CI_MERGE_REQUEST_IID") == "" {
+			return nil
+		}
+		return &PullRequest{
+			Number:  getenv("CI_MERGE_REQUEST_IID"),
+			BaseRef: getenv("CI_MERGE_REQUEST_TARGET_BRANCH_NAME"),
+			HeadRef: getenv("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME"),
+			BaseSha: getenv("CI_MERGE_REQUEST_DIFF_BASE_SHA"),
+			HeadSha: firstEnv(getenv, "CI_MERGE_REQUEST_SOURCE_BRANCH_SHA", "CI_COMMIT_SHA"),
+			Author:  getenv("GITLAB_USER_LOGIN"),
+		}
+	}},
+	{name: "buildkite", marker: "BUILDKITE", read: func(getenv func(string) string) *Context {
+		c := &Context{Branch: getenv("BUILDKITE_BRANCH"), CloneUrl: getenv("BUILDKITE_REPO")}
+		// BUILDKITE_COMMIT may be "HEAD" for builds not tied to a commit.
+		if sha := getenv("BUILDKITE_COMMIT"); isSha(sha) {
+			c.CommitSha = sha
+		}
+		return c
+	}, baseRef: func(getenv func(string) string) string {
+		if getenv("BUILDKITE_PULL_REQUEST") == "false" {
+			return ""
+		}
+		return getenv("BUILDKITE_PULL_REQUEST_BASE_BRANCH")
+	}, pullRequest: func(getenv func(string) string) *PullRequest {
+		if number := getenv("BUILDKITE_PULL_REQUEST"); number == "" || number == "false" {
+			return nil
+		}
+		pr := &PullRequest{
+			Number:  getenv("BUILDKITE_PULL_REQUEST"),
+			BaseRef: getenv("BUILDKITE_PULL_REQUEST_BASE_BRANCH"),
+			HeadRef: getenv("BUILDKITE_BRANCH"),
+			Author:  getenv("BUILDKITE_BUILD_AUTHOR"),
+		}
+		if sha := getenv("BUILDKITE_COMMIT"); isSha(sha) {
+			pr.HeadSha = sha
+		}
+		return pr
+	}},
+	{name: "bitbucket_pipelines", marker: "BITBUCKET_BUILD_NUMBER", read: func(getenv func(string) string) *Context {
+		return &Context{
+			CommitSha: getenv("BITBUCKET_COMMIT"),
+			Branch:    getenv("BITBUCKET_BRANCH"),
+			CloneUrl:  getenv("BITBUCKET_GIT_HTTP_ORIGIN"),
+		}
+	}, baseRef: func(getenv func(string) string) string {
+		return getenv("BITBUCKET_PR_DESTINATION_BRANCH")
+	}, pullRequest: func(getenv func(string) string) *PullRequest {
+		if getenv("BITBUCKET_PR_ID") == "" {
+			return nil
+		}
+		return &PullRequest{
+			Number:  getenv("BITBUCKET_PR_ID"),
+			BaseRef: getenv("BITBUCKET_PR_DESTINATION_BRANCH"),
+			HeadRef: getenv("BITBUCKET_BRANCH"),
+			HeadSha: getenv("BITBUCKET_COMMIT"),
+		}
+	}},
+	{name: "circleci", marker: "CIRCLECI", read: func(getenv func(string) string) *Context {
+		return &Context{
+			CommitSha: getenv("CIRCLE_SHA1"),
+			Branch:    getenv("CIRCLE_BRANCH"),
+			CloneUrl:  getenv("CIRCLE_REPOSITORY_URL"),
+		}
+	}, pullRequest: func(getenv func(string) string) *PullRequest {
+		if getenv("CIRCLE_PULL_REQUEST") == "" {
+			return nil
+		}
+		// CircleCI knows the pull request's URL but not its base.
+		return &PullRequest{
+			Number:  numberFromUrl(getenv("CIRCLE_PULL_REQUEST")),
+			HeadRef: getenv("CIRCLE_BRANCH"),
+			HeadSha: getenv("CIRCLE_SHA1"),
+			Author:  getenv("CIRCLE_USERNAME"),
+		}
+	}},
+	{name: "azure_pipelines", marker: "TF_BUILD", read: func(getenv func(string) string) *Context {
+		c := &Context{CommitSha: getenv("BUILD_SOURCEVERSION"), CloneUrl: getenv("BUILD_REPOSITORY_URI")}
+		if branch := getenv("SYSTEM_PULLREQUEST_SOURCEBRANCH"); branch != "" {
+			c.Branch = strings.TrimPrefix(branch, "refs/heads/")
+		} else if ref := getenv("BUILD_SOURCEBRANCH"); strings.HasPrefix(ref, "refs/heads/") {
+			c.Branch = strings.TrimPrefix(ref, "refs/heads/")
+		}
+		return c
+	}, baseRef: func(getenv func(string) string) string {
+		return strings.TrimPrefix(getenv("SYSTEM_PULLREQUEST_TARGETBRANCH"), "refs/heads/")
+	}, pullRequest: func(getenv func(string) string) *PullRequest {
+		number := firstEnv(getenv, "SYSTEM_PULLREQUEST_PULLREQUESTNUMBER", "SYSTEM_PULLREQUEST_PULLREQUESTID")
+		if number == "" {
+			return nil
+		}
+		return &PullRequest{
+			Number:  number,
+			BaseRef: strings.TrimPrefix(getenv("SYSTEM_PULLREQUEST_TARGETBRANCH"), "refs/heads/"),
+			HeadRef: strings.TrimPrefix(getenv("SYSTEM_PULLREQUEST_SOURCEBRANCH"), "refs/heads/"),
+			HeadSha: getenv("SYSTEM_PULLREQUEST_SOURCECOMMITID"),
+			Author:  getenv("BUILD_REQUESTEDFOR"),
+		}
+	}},
+	{name: "jenkins", marker: "JENKINS_URL", read: func(getenv func(string) string) *Context {
+		return &Context{
+			CommitSha: getenv("GIT_COMMIT"),
+			// GIT_BRANCH of the git plugin is "origin/main".
+			Branch:   strings.TrimPrefix(firstEnv(getenv, "CHANGE_BRANCH", "BRANCH_NAME", "GIT_BRANCH"), "origin/"),
+			CloneUrl: getenv("GIT_URL"),
+		}
+	}, baseRef: func(getenv func(string) string) string {
+		return getenv("CHANGE_TARGET")
+	}, pullRequest: func(getenv func(string) string) *PullRequest {
+		if getenv("CHANGE_ID") == "" {
+			return nil
+		}
+		return &PullRequest{
+			Number:  getenv("CHANGE_ID"),
+			BaseRef: getenv("CHANGE_TARGET"),
+			HeadRef: getenv("CHANGE_BRANCH"),
+			Author:  getenv("CHANGE_AUTHOR"),
+		}
+	}},
+}
+
+// ciContext returns the checkout of the CI system synq-dbt runs in, or nil
+// outside CI. Pull and merge requests resolve to their source branch.
+func ciContext(getenv func(string) string) (*Context, string) {
+	for _, system := range ciSystems {
+		if getenv(system.marker) == "" {
+			continue
+		}
+		c := system.read(getenv)
+		c.CommitSha = strings.TrimSpace(c.CommitSha)
+		c.Branch = strings.TrimSpace(c.Branch)
+		c.CloneUrl = strings.TrimSpace(c.CloneUrl)
+		return c, system.name
+	}
+	return nil, ""
+}
+
+// ciBranch returns the branch a CI system checked out, for detached HEADs.
+func ciBranch(getenv func(string) string) string {
+	if c, _ := ciContext(getenv); c != nil {
+		return c.Branch
+	}
+	return ""
+}
+
+// applyOverrides sets the fields given in SYNQ_GIT_SHA, SYNQ_GIT_BRANCH and
+// SYNQ_GIT_URL.
+func applyOverrides(c *Context, getenv func(string) string) *Context {
+	sha, branch, url := strings.TrimSpace(getenv(ShaEnv)), strings.TrimSpace(getenv(BranchEnv)), strings.TrimSpace(getenv(UrlEnv))
+	if sha == "" && branch == "" && url == "" {
+		return c
+	}
+	if c == nil {
+		c = &Context{Source: SourceEnv}
+	}
+	if sha != "" && sha != c.CommitSha {
+		// The details of the detected commit don't describe this one.
+		*c = Context{CloneUrl: c.CloneUrl, Branch: c.Branch, CommitSha: sha, Source: SourceEnv}
+	}
+	if branch != "" {
+		c.Branch = branch
+		c.Detached = false
+	}
+	if url != "" {
+		c.CloneUrl = url
+	}
+	return c
+}
+
+func firstEnv(getenv func(string) string, names ...string) string {
+	for _, name := range names {
+		if value := strings.TrimSpace(getenv(name)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// BaseRefEnv sets the ref changed files are listed against, e.g. "main" or
+// a commit SHA. Without it the target of the CI system's pull or merge
+// request is used.
+const BaseRefEnv = "SYNQ_GIT_BASE_REF"
+
+// DbtFileExtensions are the files ChangedFiles considers relevant to dbt.
+var DbtFileExtensions = []string{".sql", ".py", ".yml", ".yaml", ".csv", ".md", ".jinja"}
+
+// BaseRef returns the ref to list changed files against, or "" when the run
+// is not for a pull or merge request.
+func BaseRef() string {
+	return baseRef(os.Getenv)
+}
+
+func baseRef(getenv func(string) string) string {
+	if ref := strings.TrimSpace(getenv(BaseRefEnv)); ref != "" {
+		return ref
+	}
+	for _, system := range ciSystems {
+		if getenv(system.marker) == "" || system.baseRef == nil {
+			continue
+		}
+		return strings.TrimSpace(system.baseRef(getenv))
+	}
+	return ""
+}
+
+// ChangedFiles lists the dbt files changed on HEAD since it diverged from
+// baseRef, relative to dir, which is usually the dbt project directory.
+// Changes outside dir are left out. CI checkouts often only have the
+// remote-tracking branch, so "origin/<baseRef>" is tried as well.
+func ChangedFiles(ctx context.Context, dir, baseRef string) ([]string, error) {
+	if !commandExists("git") {
+		return nil, fmt.Errorf("git is not installed")
+	}
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	for _, ref := range baseRefCandidates(baseRef) {
+		// "base...HEAD" diffs against the merge base, so changes made
+		// on the base branch since are not counted.
+		out, err := runGitErr(ctx, dir, "diff", "--name-only", "--relative", "-z", ref+"...HEAD", "--")
+		if err != nil {
+			continue
+		}
+		var files []string
+		for _, file := range strings.Split(out, "\x00") {
+			if file != "" && isDbtFile(file) {
+				files = append(files, file)
+			}
+		}
+		return files, nil
+	}
+	return nil, fmt.Errorf("base ref %q not found, it may need to be fetched", baseRef)
+}
+
+// baseRefCandidates returns baseRef and, for a branch, its remote-tracking
+// branch.
+func baseRefCandidates(baseRef string) []string {
+	candidates := []string{baseRef}
+	if !isSha(baseRef) && !strings.HasPrefix(baseRef, "origin/") {
+		candidates = append(candidates, "origin/"+baseRef)
+	}
+	return candidates
+}
+
+func isDbtFile(file string) bool {
+	ext := strings.ToLower(path.Ext(file))
+	for _, dbtExt := range DbtFileExtensions {
+		if ext == dbtExt {
+			return true
+		}
+	}
+	return false
+}
+
+// Keys of the changed files in the uploaded environment.
+const (
+	// BaseRefKey is the ref the files were listed against.
+	BaseRefKey = BaseRefEnv
+	// DiffKey maps each changed file to the manifest nodes defined in it,
+	// as a JSON object.
+	DiffKey = "SYNQ_GIT_DIFF"
+	// DiffTruncatedKey is "true" when changed files were left out, past
+	// MaxDiffFiles or MaxDiffSize.
+	DiffTruncatedKey = "SYNQ_GIT_DIFF_TRUNCATED"
+)
+
+// MaxDiffFiles bounds the changed files uploaded, a large refactoring must
+// not bloat every upload.
+const MaxDiffFiles = 1000
+
+// MaxDiffSize bounds the DiffKey value in bytes. It is its own limit, not
+// that of collected environment values: MaxDiffFiles files with their
+// node ids take a few hundred KiB.
+const MaxDiffSize = 512 << 10
@@ -0,0 +1,90 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBaseRef(t *testing.T) {
+	tests := map[string]struct {
+		env  map[string]string
+		want string
+	}{
+		"none":           {},
+		"github push":    {env: map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_BASE_REF": ""}},
+		"github pr":      {env: map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_BASE_REF": "main"}, want: "main"},
+		"gitlab mr":      {env: map[string]string{"GITLAB_CI": "true", "CI_MERGE_REQUEST_TARGET_BRANCH_NAME": "main", "CI_MERGE_REQUEST_DIFF_BASE_SHA": testSha}, want: testSha},
+		"buildkite push": {env: map[string]string{"BUILDKITE": "true", "BUILDKITE_PULL_REQUEST": "false", "BUILDKITE_PULL_REQUEST_BASE_BRANCH": "main"}},
+		"azure pr":       {env: map[string]string{"TF_BUILD": "True", "SYSTEM_PULLREQUEST_TARGETBRANCH": "refs/heads/develop"}, want: "develop"},
+		"explicit":       {env: map[string]string{BaseRefEnv: "release", "GITHUB_ACTIONS": "true", "GITHUB_BASE_REF": "main"}, want: "release"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := baseRef(func(name string) string { return tt.env[name] }); got != tt.want {
+				t.Errorf("baseRef() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	if !commandExists("git") {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	gitCmd := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=Ada", "GIT_AUTHOR_EMAIL=ada@example.com", "GIT_COMMITTER_NAME=Ada", "GIT_COMMITTER_EMAIL=ada@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(repo, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gitCmd("init", "-q", "-b", "main")
+	write("dbt/models/orders.sql", "select 1")
+	write("dbt/models/schema.yml", "version: 2")
+	write("README.md", "analytics")
+	gitCmd("add", ".")
+	gitCmd("commit", "-q", "-m", "Initial")
+	gitCmd("checkout", "-q", "-b", "feature")
+	write("dbt/models/orders.sql", "select 2")
+	write("dbt/models/customers.sql", "select 3")
+	write("dbt/models/notes.txt", "not dbt")
+	write("README.md", "changed outside the project")
+	gitCmd("add", ".")
+	gitCmd("commit", "-q", "-m", "Change orders")
+	// Changes on main after the branch point are not the branch's.
+	gitCmd("checkout", "-q", "main")
+	write("dbt/models/schema.yml", "version: 2 # main")
+	gitCmd("commit", "-q", "-am", "Change schema on main")
+	gitCmd("checkout", "-q", "feature")
+
+	got, err := ChangedFiles(context.Background(), filepath.Join(repo, "dbt"), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"models/customers.sql", "models/orders.sql"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ChangedFiles() = %v, want %v", got, want)
+	}
+
+	if _, err := ChangedFiles(context.Background(), repo, "missing"); err == nil {
+		t.Errorf("expected an error for a missing base ref")
+	}
+}
@@ -0,0 +1,177 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readDotGit describes the checkout in dir by reading its .git directly, for
+// images without a git binary. It knows the commit, the branch and the
+// remote, not the commit's details or the worktree state. It returns nil
+// when dir is not inside a repository.
+func readDotGit(dir string) *Context {
+	gitDir, ok := findGitDir(dir)
+	if !ok {
+		return nil
+	}
+	commonDir := commonGitDir(gitDir)
+
+	head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return nil
+	}
+	c := &Context{CloneUrl: readRemoteUrl(filepath.Join(commonDir, "config"), "origin")}
+	if ref, symbolic := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: "); symbolic {
+		c.Branch = strings.TrimPrefix(ref, "refs/heads/")
+		c.CommitSha = resolveRef(gitDir, commonDir, ref)
+	} else {
+		c.CommitSha = strings.TrimSpace(string(head))
+		c.Detached = true
+	}
+	if !isSha(c.CommitSha) {
+		c.CommitSha = ""
+	}
+	return c
+}
+
+// commonGitDir returns the directory holding the refs and config of gitDir.
+// Linked worktrees keep HEAD in their own directory and everything else in
+// the main repository's.
+func commonGitDir(gitDir string) string {
+	if common, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		return inDir(gitDir, strings.TrimSpace(string(common)))
+	}
+	return gitDir
+}
+
+// remoteUrl returns the url of the remote of the repository dir is in.
+func remoteUrl(dir, remote string) string {
+	gitDir, ok := findGitDir(dir)
+	if !ok {
+		return ""
+	}
+	return readRemoteUrl(filepath.Join(commonGitDir(gitDir), "config"), remote)
+}
+
+// findGitDir walks up from dir to the repository's git directory. A .git
+// file, as in worktrees and submodules, points to it with "gitdir: <path>".
+func findGitDir(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		if info, err := os.Stat(dotGit); err == nil {
+			if info.IsDir() {
+				return dotGit, true
+			}
+			content, err := os.ReadFile(dotGit)
+			if err != nil {
+				return "", false
+			}
+			if gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir: "); ok {
+				return inDir(dir, gitDir), true
+			}
+			return "", false
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// resolveRef follows ref through symbolic refs, loose refs and packed-refs
+// to a commit SHA.
+func resolveRef(gitDir, commonDir, ref string) string {
+	for depth := 0; depth < 5; depth++ {
+		var content []byte
+		var err error
+		for _, dir := range []string{gitDir, commonDir} {
+			if content, err = os.ReadFile(filepath.Join(dir, filepath.FromSlash(ref))); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return packedRefs(commonDir)[ref]
+		}
+		value := strings.TrimSpace(string(content))
+		next, symbolic := strings.CutPrefix(value, "ref: ")
+		if !symbolic {
+			return value
+		}
+		ref = next
+	}
+	return ""
+}
+
+// packedRefs reads packed-refs, mapping ref names to what they point to.
+// Peeled "^<sha>" lines of annotated tags are skipped.
+func packedRefs(commonDir string) map[string]string {
+	refs := map[string]string{}
+	content, err := os.ReadFile(filepath.Join(commonDir, "packed-refs"))
+	if err != nil {
+		return refs
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		if sha, name, ok := strings.Cut(strings.TrimSpace(line), " "); ok {
+			refs[name] = sha
+		}
+	}
+	return refs
+}
+
+// readRemoteUrl returns the url of the remote from a git config file.
+func readRemoteUrl(configFile, remote string) string {
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		return ""
+	}
+	section := `remote "` + remote + `"`
+	inSection := false
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			inSection = strings.TrimSpace(strings.Trim(line, "[]")) == section
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok && strings.EqualFold(strings.TrimSpace(key), "url") {
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return ""
+}
+
+func inDir(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(dir, path)
+}
+
+func isSha(value string) bool {
+	if len(value) != 40 && len(value) != 64 {
+		return false
+	}
+	for _, r := range value {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
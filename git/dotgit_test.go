@@ -0,0 +1,148 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const (
+	testSha      = "0123456789abcdef0123456789abcdef01234567"
+	testOtherSha = "89abcdef0123456789abcdef0123456789abcdef"
+)
+
+const testConfig = `[core]
+	repositoryformatversion = 0
+	bare = false
+[remote "upstream"]
+	url = https://example.com/fork/analytics.git
+[remote "origin"]
+	url = git@github.com:acme/analytics.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+[branch "main"]
+	remote = origin
+`
+
+// writeFixture lays out files, relative to a new directory, and returns the
+// directory.
+func writeFixture(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestReadDotGit(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		dir   string
+		want  *Context
+	}{
+		{
+			name: "loose ref",
+			files: map[string]string{
+				".git/HEAD":            "ref: refs/heads/main\n",
+				".git/refs/heads/main": testSha + "\n",
+				".git/config":          testConfig,
+				"dbt/dbt_project.yml":  "name: analytics\n",
+			},
+			dir:  "dbt",
+			want: &Context{CloneUrl: "git@github.com:acme/analytics.git", Branch: "main", CommitSha: testSha},
+		},
+		{
+			name: "packed ref",
+			files: map[string]string{
+				".git/HEAD": "ref: refs/heads/feature/orders\n",
+				".git/packed-refs": "# pack-refs with: peeled fully-peeled sorted\n" +
+					testOtherSha + " refs/heads/feature/orders\n" +
+					testSha + " refs/tags/v1\n" +
+					"^" + testOtherSha + "\n",
+			},
+			want: &Context{Branch: "feature/orders", CommitSha: testOtherSha},
+		},
+		{
+			name: "detached",
+			files: map[string]string{
+				".git/HEAD":   testSha + "\n",
+				".git/config": testConfig,
+			},
+			want: &Context{CloneUrl: "git@github.com:acme/analytics.git", CommitSha: testSha, Detached: true},
+		},
+		{
+			name: "unborn branch",
+			files: map[string]string{
+				".git/HEAD": "ref: refs/heads/main\n",
+			},
+			want: &Context{Branch: "main"},
+		},
+		{
+			name: "worktree",
+			files: map[string]string{
+				"main/.git/config":                     testConfig,
+				"main/.git/refs/heads/main":            testOtherSha + "\n",
+				"main/.git/refs/heads/hotfix":          testSha + "\n",
+				"main/.git/worktrees/hotfix/HEAD":      "ref: refs/heads/hotfix\n",
+				"main/.git/worktrees/hotfix/commondir": "../..\n",
+				"hotfix/.git":                          "gitdir: ../main/.git/worktrees/hotfix\n",
+				"hotfix/models/orders.sql":             "select 1\n",
+			},
+			dir:  "hotfix/models",
+			want: &Context{CloneUrl: "git@github.com:acme/analytics.git", Branch: "hotfix", CommitSha: testSha},
+		},
+		{
+			name: "submodule",
+			files: map[string]string{
+				".git/HEAD":               "ref: refs/heads/main\n",
+				".git/refs/heads/main":    testOtherSha + "\n",
+				".git/modules/dbt/HEAD":   testSha + "\n",
+				".git/modules/dbt/config": "[remote \"origin\"]\n\turl = \"https://example.com/acme/dbt.git\"\n",
+				"dbt/.git":                "gitdir: ../.git/modules/dbt\n",
+			},
+			dir:  "dbt",
+			want: &Context{CloneUrl: "https://example.com/acme/dbt.git", CommitSha: testSha, Detached: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeFixture(t, tt.files)
+			got := readDotGit(filepath.Join(root, tt.dir))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readDotGit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadDotGit_NoRepository(t *testing.T) {
+	if got := readDotGit(t.TempDir()); got != nil {
+		t.Errorf("expected nil outside a repository, got %+v", got)
+	}
+}
+
+func TestCollect_WithoutGitBinary(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	clearCiEnv(t)
+	t.Setenv("GITLAB_CI", "true")
+	t.Setenv("CI_COMMIT_BRANCH", "feature")
+	root := writeFixture(t, map[string]string{
+		".git/HEAD":   testSha + "\n",
+		".git/config": testConfig,
+	})
+
+	got := Collect(context.Background(), root)
+	want := &Context{CloneUrl: "https://github.com/acme/analytics", Branch: "feature", CommitSha: testSha, Detached: true, Source: SourceDotGit}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Collect() = %+v, want %+v", got, want)
+	}
+}
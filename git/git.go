@@ -1,59 +1,252 @@
 package git
 
 import (
-	ingestgitv1 "buf.build/gen/go/getsynq/api/protocolbuffers/go/synq/ingest/git/v1"
+	"bytes"
 	"context"
+	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
+
+	ingestgitv1 "buf.build/gen/go/getsynq/api/protocolbuffers/go/synq/ingest/git/v1"
 )
 
-func CollectGitContext(ctx context.Context, dir string) *ingestgitv1.GitContext {
-	if !commandExists("git") {
+// Keys of the git details the ingest API has no fields for, sent in the
+// uploaded environment.
+const (
+	AuthorNameKey     = "SYNQ_GIT_AUTHOR_NAME"
+	AuthorEmailKey    = "SYNQ_GIT_AUTHOR_EMAIL"
+	AuthorTimeKey     = "SYNQ_GIT_AUTHOR_TIME"
+	CommitterNameKey  = "SYNQ_GIT_COMMITTER_NAME"
+	CommitterEmailKey = "SYNQ_GIT_COMMITTER_EMAIL"
+	CommitTimeKey     = "SYNQ_GIT_COMMIT_TIME"
+	SubjectKey        = "SYNQ_GIT_SUBJECT"
+	TagsKey           = "SYNQ_GIT_TAGS"
+	DirtyKey          = "SYNQ_GIT_DIRTY"
+	ChangedFilesKey   = "SYNQ_GIT_CHANGED_FILES"
+	DetachedKey       = "SYNQ_GIT_DETACHED"
+	SourceKey         = "SYNQ_GIT_SOURCE"
+)
+
+// Sources of a Context.
+const (
+	SourceGit    = "git"
+	SourceDotGit = "dotgit"
+	// SourceCI is followed by the CI system, e.g. "ci:gitlab_ci".
+	SourceCI  = "ci:"
+	SourceEnv = "env"
+)
+
+const gitTimeout = 10 * time.Second
+
+// Context describes the checkout a dbt project runs from.
+type Context struct {
+	CloneUrl  string
+	Branch    string
+	CommitSha string
+
+	AuthorName     string
+	AuthorEmail    string
+	AuthorTime     time.Time
+	CommitterName  string
+	CommitterEmail string
+	CommitTime     time.Time
+	Subject        string
+	// Tags point at the commit.
+	Tags []string
+
+	// Dirty is set when the worktree has uncommitted changes, including
+	// untracked files; ChangedFiles counts them.
+	Dirty        bool
+	ChangedFiles int
+	// Detached is set when HEAD is not a branch, as in most CI checkouts.
+	// Branch is then taken from the CI environment where possible.
+	Detached bool
+
+	// Source tells where the context was read from, one of the Source*
+	// constants.
+	Source string
+}
+
+// Proto returns the fields of the ingest API's GitContext.
+func (c *Context) Proto() *ingestgitv1.GitContext {
+	if c == nil {
 		return nil
 	}
-
 	return &ingestgitv1.GitContext{
-		CloneUrl:  getCloneUrl(ctx, dir),
-		Branch:    getCurrentBranch(ctx, dir),
-		CommitSha: getCommitSHA(ctx, dir),
+		CloneUrl:  c.CloneUrl,
+		Branch:    c.Branch,
+		CommitSha: c.CommitSha,
 	}
 }
 
-func getCurrentBranch(ctx context.Context, dir string) string {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-	cmd := exec.CommandContext(ctx, "git", "rev-parse", "--abbrev-ref", "HEAD")
-	cmd.Dir = dir
-	out, err := cmd.Output()
-	if err != nil {
-		return ""
+// Metadata returns the remaining non-empty fields under the SYNQ_GIT_* keys.
+// Times are RFC3339, tags are comma-separated.
+func (c *Context) Metadata() map[string]string {
+	metadata := map[string]string{}
+	if c == nil {
+		return metadata
+	}
+	for key, value := range map[string]string{
+		AuthorNameKey:     c.AuthorName,
+		AuthorEmailKey:    c.AuthorEmail,
+		CommitterNameKey:  c.CommitterName,
+		CommitterEmailKey: c.CommitterEmail,
+		SubjectKey:        c.Subject,
+		TagsKey:           strings.Join(c.Tags, ","),
+		SourceKey:         c.Source,
+	} {
+		if value != "" {
+			metadata[key] = value
+		}
+	}
+	if !c.AuthorTime.IsZero() {
+		metadata[AuthorTimeKey] = c.AuthorTime.Format(time.RFC3339)
+	}
+	if !c.CommitTime.IsZero() {
+		metadata[CommitTimeKey] = c.CommitTime.Format(time.RFC3339)
 	}
-	return strings.TrimSpace(string(out))
+	// Only a repository tells the state of the worktree and HEAD.
+	if c.Source == SourceGit {
+		metadata[DirtyKey] = strconv.FormatBool(c.Dirty)
+		metadata[ChangedFilesKey] = strconv.Itoa(c.ChangedFiles)
+	}
+	if c.Source == SourceGit || c.Source == SourceDotGit {
+		metadata[DetachedKey] = strconv.FormatBool(c.Detached)
+	}
+	return metadata
 }
 
-func getCommitSHA(ctx context.Context, dir string) string {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-	cmd := exec.CommandContext(ctx, "git", "rev-parse", "HEAD")
-	cmd.Dir = dir
-	out, err := cmd.Output()
-	if err != nil {
-		return ""
+// CollectGitContext returns the ingest API's GitContext of the checkout in
+// dir, see Collect.
+func CollectGitContext(ctx context.Context, dir string) *ingestgitv1.GitContext {
+	return Collect(ctx, dir).Proto()
+}
+
+// Collect describes the checkout in dir, or returns nil when nothing is
+// known about it. HEAD and the worktree state come from a single git call,
+// the remote from the repository's config. Without a git binary, or when git refuses the repository
+// (e.g. for its owner), .git is read directly, see readDotGit. Without a
+// repository, e.g. in an image holding only the dbt project, the checkout of
+// the CI system is used. SYNQ_GIT_SHA, SYNQ_GIT_BRANCH and SYNQ_GIT_URL
+// override whatever was found. The clone URL is stripped of credentials,
+// see NormalizeCloneUrl.
+func Collect(ctx context.Context, dir string) *Context {
+	c := applyOverrides(detect(ctx, dir, os.Getenv), os.Getenv)
+	if c != nil {
+		c.CloneUrl = NormalizeCloneUrl(c.CloneUrl)
 	}
-	return strings.TrimSpace(string(out))
+	return c
 }
 
-func getCloneUrl(ctx context.Context, dir string) string {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+func detect(ctx context.Context, dir string, getenv func(string) string) *Context {
+	if commandExists("git") {
+		if c := collectWithGit(ctx, dir); c.CommitSha != "" {
+			c.Source = SourceGit
+			return resolveDetached(c, getenv)
+		}
+	}
+	if c := readDotGit(dir); c != nil && c.CommitSha != "" {
+		c.Source = SourceDotGit
+		return resolveDetached(c, getenv)
+	}
+	if c, system := ciContext(getenv); c != nil && c.CommitSha != "" {
+		c.Source = SourceCI + system
+		return c
+	}
+	return nil
+}
+
+func resolveDetached(c *Context, getenv func(string) string) *Context {
+	if c.Detached {
+		c.Branch = ciBranch(getenv)
+	}
+	return c
+}
+
+func collectWithGit(ctx context.Context, dir string) *Context {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
 	defer cancel()
-	cmd := exec.CommandContext(ctx, "git", "remote", "get-url", "origin")
+
+	// One git process prints HEAD on the first line, the subject can't
+	// span lines, followed by the worktree status. The remote is read from
+	// the repository's config instead.
+	out := runGit(ctx, dir, "-c", "alias.synq-context=!git log -1 --no-show-signature --decorate=full '--format="+headFormat+"'"+
+		" && git status --porcelain --untracked-files=normal", "synq-context")
+	head, status, _ := strings.Cut(out, "\n")
+
+	c := parseHead(head)
+	if c.CommitSha != "" {
+		c.CloneUrl = remoteUrl(dir, "origin")
+		c.ChangedFiles = countChanges(status)
+		c.Dirty = c.ChangedFiles > 0
+	}
+	return c
+}
+
+// headFormat separates the fields of HEAD by NUL bytes, the subject comes
+// last. %D lists the refs pointing at HEAD, see parseRefs.
+const headFormat = "%H%x00%an%x00%ae%x00%aI%x00%cn%x00%ce%x00%cI%x00%D%x00%s"
+
+func parseHead(out string) *Context {
+	c := &Context{}
+	fields := strings.Split(strings.TrimRight(out, "\n"), "\x00")
+	if len(fields) != 9 {
+		return c
+	}
+	c.CommitSha = fields[0]
+	c.AuthorName, c.AuthorEmail = fields[1], fields[2]
+	c.AuthorTime, _ = time.Parse(time.RFC3339, fields[3])
+	c.CommitterName, c.CommitterEmail = fields[4], fields[5]
+	c.CommitTime, _ = time.Parse(time.RFC3339, fields[6])
+	c.Branch, c.Tags, c.Detached = parseRefs(fields[7])
+	c.Subject = fields[8]
+	return c
+}
+
+// parseRefs reads the full ref names of --decorate=full, e.g.
+// "HEAD -> refs/heads/main, tag: refs/tags/v1.2, refs/remotes/origin/main".
+// A detached HEAD shows as a plain "HEAD".
+func parseRefs(decorations string) (branch string, tags []string, detached bool) {
+	detached = true
+	for _, ref := range strings.Split(decorations, ", ") {
+		switch {
+		case strings.HasPrefix(ref, "HEAD -> "):
+			branch = strings.TrimPrefix(strings.TrimPrefix(ref, "HEAD -> "), "refs/heads/")
+			detached = false
+		case strings.HasPrefix(ref, "tag: "):
+			tags = append(tags, strings.TrimPrefix(strings.TrimPrefix(ref, "tag: "), "refs/tags/"))
+		}
+	}
+	return branch, tags, detached
+}
+
+// countChanges counts the entries of git status --porcelain.
+func countChanges(status string) int {
+	count := 0
+	for _, line := range strings.Split(status, "\n") {
+		if strings.TrimSpace(line) != "" {
+			count++
+		}
+	}
+	return count
+}
+
+func runGit(ctx context.Context, dir string, args ...string) string {
+	out, _ := runGitErr(ctx, dir, args...)
+	return out
+}
+
+func runGitErr(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
 	cmd.Dir = dir
-	out, err := cmd.Output()
-	if err != nil {
-		return ""
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", err
 	}
-	return strings.TrimSpace(string(out))
+	return stdout.String(), nil
 }
 
 func commandExists(cmd string) bool {
@@ -0,0 +1,184 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Variables which override what is detected about the pull request.
+const (
+	PullRequestNumberEnv  = "SYNQ_PR_NUMBER"
+	PullRequestBaseShaEnv = "SYNQ_PR_BASE_SHA"
+	PullRequestHeadShaEnv = "SYNQ_PR_HEAD_SHA"
+	PullRequestAuthorEnv  = "SYNQ_PR_AUTHOR"
+)
+
+// Keys of the pull request in the uploaded environment.
+const (
+	PullRequestNumberKey  = PullRequestNumberEnv
+	PullRequestBaseRefKey = "SYNQ_PR_BASE_REF"
+	PullRequestHeadRefKey = "SYNQ_PR_HEAD_REF"
+	PullRequestBaseShaKey = PullRequestBaseShaEnv
+	PullRequestHeadShaKey = PullRequestHeadShaEnv
+	PullRequestAuthorKey  = PullRequestAuthorEnv
+)
+
+// PullRequest describes the pull or merge request a CI run is for.
+type PullRequest struct {
+	Number string
+	// BaseRef is the branch the request targets, HeadRef the one it
+	// merges.
+	BaseRef string
+	HeadRef string
+	// BaseSha is the commit the head branch is compared with, HeadSha its
+	// latest commit. CI systems often check out a merge commit instead of
+	// HeadSha.
+	BaseSha string
+	HeadSha string
+	Author  string
+}
+
+// Metadata returns the non-empty fields under the SYNQ_PR_* keys.
+func (p *PullRequest) Metadata() map[string]string {
+	metadata := map[string]string{}
+	if p == nil {
+		return metadata
+	}
+	for key, value := range map[string]string{
+		PullRequestNumberKey:  p.Number,
+		PullRequestBaseRefKey: p.BaseRef,
+		PullRequestHeadRefKey: p.HeadRef,
+		PullRequestBaseShaKey: p.BaseSha,
+		PullRequestHeadShaKey: p.HeadSha,
+		PullRequestAuthorKey:  p.Author,
+	} {
+		if value != "" {
+			metadata[key] = value
+		}
+	}
+	return metadata
+}
+
+// DetectPullRequest returns the pull or merge request the CI system runs
+// for, with SYNQ_PR_NUMBER, SYNQ_PR_BASE_SHA, SYNQ_PR_HEAD_SHA and
+// SYNQ_PR_AUTHOR overriding what was detected. Missing SHAs are taken from
+// the checkout in dir: HEAD, and its merge base with the base branch. It
+// returns nil when the run is not for a pull request.
+func DetectPullRequest(ctx context.Context, dir string) *PullRequest {
+	pr := detectPullRequest(os.Getenv)
+	if pr == nil {
+		return nil
+	}
+	if pr.HeadSha == "" {
+		if c := Collect(ctx, dir); c != nil {
+			pr.HeadSha = c.CommitSha
+		}
+	}
+	if pr.BaseSha == "" && pr.BaseRef != "" {
+		pr.BaseSha = mergeBase(ctx, dir, pr.BaseRef)
+	}
+	return pr
+}
+
+func detectPullRequest(getenv func(string) string) *PullRequest {
+	var pr *PullRequest
+	for _, system := range ciSystems {
+		if getenv(system.marker) != "" && system.pullRequest != nil {
+			pr = system.pullRequest(getenv)
+			break
+		}
+	}
+
+	for _, override := range []struct {
+		env   string
+		field func(*PullRequest) *string
+	}{
+		{PullRequestNumberEnv, func(pr *PullRequest) *string { return &pr.Number }},
+		{PullRequestBaseShaEnv, func(pr *PullRequest) *string { return &pr.BaseSha }},
+		{PullRequestHeadShaEnv, func(pr *PullRequest) *string { return &pr.HeadSha }},
+		{PullRequestAuthorEnv, func(pr *PullRequest) *string { return &pr.Author }},
+	} {
+		value := strings.TrimSpace(getenv(override.env))
+		if value == "" {
+			continue
+		}
+		if pr == nil {
+			pr = &PullRequest{}
+		}
+		*override.field(pr) = value
+	}
+	if pr != nil && pr.BaseRef == "" {
+		pr.BaseRef = strings.TrimSpace(getenv(BaseRefEnv))
+	}
+	return pr
+}
+
+// githubPullRequest reads the pull request from the event payload, the
+// environment only has the merge commit and no number.
+func githubPullRequest(getenv func(string) string) *PullRequest {
+	if getenv("GITHUB_BASE_REF") == "" {
+		return nil
+	}
+	pr := &PullRequest{
+		BaseRef: getenv("GITHUB_BASE_REF"),
+		HeadRef: getenv("GITHUB_HEAD_REF"),
+		Author:  getenv("GITHUB_ACTOR"),
+	}
+	// GITHUB_REF is "refs/pull/<number>/merge".
+	if ref := getenv("GITHUB_REF"); strings.HasPrefix(ref, "refs/pull/") {
+		pr.Number = strings.Split(strings.TrimPrefix(ref, "refs/pull/"), "/")[0]
+	}
+
+	var event struct {
+		Number      int `json:"number"`
+		PullRequest struct {
+			User struct {
+				Login string `json:"login"`
+			} `json:"user"`
+			Base struct {
+				Sha string `json:"sha"`
+			} `json:"base"`
+			Head struct {
+				Sha string `json:"sha"`
+			} `json:"head"`
+		} `json:"pull_request"`
+	}
+	if content, err := os.ReadFile(getenv("GITHUB_EVENT_PATH")); err == nil && json.Unmarshal(content, &event) == nil {
+		if event.Number != 0 {
+			pr.Number = strconv.Itoa(event.Number)
+		}
+		pr.BaseSha = event.PullRequest.Base.Sha
+		pr.HeadSha = event.PullRequest.Head.Sha
+		if login := event.PullRequest.User.Login; login != "" {
+			pr.Author = login
+		}
+	}
+	return pr
+}
+
+func mergeBase(ctx context.Context, dir, baseRef string) string {
+	if !commandExists("git") {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+	for _, ref := range baseRefCandidates(baseRef) {
+		if out, err := runGitErr(ctx, dir, "merge-base", ref, "HEAD"); err == nil {
+			return strings.TrimSpace(out)
+		}
+	}
+	return ""
+}
+
+// numberFromUrl returns the last path element of a pull request URL, e.g.
+// "https://github.com/acme/analytics/pull/7".
+func numberFromUrl(url string) string {
+	if url == "" {
+		return ""
+	}
+	return path.Base(strings.TrimSuffix(url, "/"))
+}
@@ -0,0 +1,102 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDetectPullRequest(t *testing.T) {
+	event := filepath.Join(t.TempDir(), "event.json")
+	content := `{"number": 7, "pull_request": {"user": {"login": "ada"}, "base": {"sha": "` + testOtherSha + `"}, "head": {"sha": "` + testSha + `"}}}`
+	if err := os.WriteFile(event, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want *PullRequest
+	}{
+		{
+			name: "none",
+			env:  map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_REF": "refs/heads/main"},
+		},
+		{
+			name: "github",
+			env: map[string]string{
+				"GITHUB_ACTIONS":    "true",
+				"GITHUB_BASE_REF":   "main",
+				"GITHUB_HEAD_REF":   "feature",
+				"GITHUB_REF":        "refs/pull/7/merge",
+				"GITHUB_ACTOR":      "bot",
+				"GITHUB_EVENT_PATH": event,
+			},
+			want: &PullRequest{Number: "7", BaseRef: "main", HeadRef: "feature", BaseSha: testOtherSha, HeadSha: testSha, Author: "ada"},
+		},
+		{
+			name: "github without event",
+			env:  map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_BASE_REF": "main", "GITHUB_HEAD_REF": "feature", "GITHUB_REF": "refs/pull/7/merge", "GITHUB_ACTOR": "bot"},
+			want: &PullRequest{Number: "7", BaseRef: "main", HeadRef: "feature", Author: "bot"},
+		},
+		{
+			name: "gitlab",
+			env: map[string]string{
+				"GITLAB_CI":                           "true",
+				"CI_COMMIT_SHA":                       testSha,
+				"CI_MERGE_REQUEST_IID":                "12",
+				"CI_MERGE_REQUEST_TARGET_BRANCH_NAME": "main",
+				"CI_MERGE_REQUEST_SOURCE_BRANCH_NAME": "feature",
+				"CI_MERGE_REQUEST_DIFF_BASE_SHA":      testOtherSha,
+				"GITLAB_USER_LOGIN":                   "ada",
+			},
+			want: &PullRequest{Number: "12", BaseRef: "main", HeadRef: "feature", BaseSha: testOtherSha, HeadSha: testSha, Author: "ada"},
+		},
+		{
+			name: "buildkite branch build",
+			env:  map[string]string{"BUILDKITE": "true", "BUILDKITE_PULL_REQUEST": "false", "BUILDKITE_BRANCH": "main"},
+		},
+		{
+			name: "circleci",
+			env:  map[string]string{"CIRCLECI": "true", "CIRCLE_PULL_REQUEST": "https://github.com/acme/analytics/pull/9", "CIRCLE_BRANCH": "feature", "CIRCLE_SHA1": testSha},
+			want: &PullRequest{Number: "9", HeadRef: "feature", HeadSha: testSha},
+		},
+		{
+			name: "overrides",
+			env: map[string]string{
+				"CIRCLECI":            "true",
+				"CIRCLE_PULL_REQUEST": "https://github.com/acme/analytics/pull/9",
+				"CIRCLE_SHA1":         testSha,
+				PullRequestNumberEnv:  "10",
+				PullRequestBaseShaEnv: testOtherSha,
+				BaseRefEnv:            "main",
+			},
+			want: &PullRequest{Number: "10", BaseRef: "main", BaseSha: testOtherSha, HeadSha: testSha},
+		},
+		{
+			name: "outside ci",
+			env:  map[string]string{PullRequestNumberEnv: "3", PullRequestAuthorEnv: "ada"},
+			want: &PullRequest{Number: "3", Author: "ada"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := detectPullRequest(func(name string) string { return tt.env[name] })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detectPullRequest() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPullRequestMetadata(t *testing.T) {
+	pr := &PullRequest{Number: "7", BaseRef: "main", HeadSha: testSha}
+	want := map[string]string{PullRequestNumberKey: "7", PullRequestBaseRefKey: "main", PullRequestHeadShaKey: testSha}
+	if got := pr.Metadata(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Metadata() = %v, want %v", got, want)
+	}
+	if got := (*PullRequest)(nil).Metadata(); len(got) != 0 {
+		t.Errorf("nil Metadata() = %v, want empty", got)
+	}
+}
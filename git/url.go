@@ -0,0 +1,60 @@
+package git
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// scpLike matches the scp-like syntax git accepts for SSH, e.g.
+// "git@github.com:acme/analytics.git".
+var scpLike = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// NormalizeCloneUrl turns a clone URL into the canonical https://host/path
+// form without credentials, as it is safe to upload: user info, query and
+// fragment are dropped, ssh://, git:// and scp-like URLs are rewritten to
+// https, and a trailing ".git" is removed. Local paths are kept without
+// user info. Anything else is dropped, it is better to upload no URL than
+// one with a token in it.
+func NormalizeCloneUrl(cloneUrl string) string {
+	cloneUrl = strings.TrimSpace(cloneUrl)
+	if cloneUrl == "" {
+		return ""
+	}
+
+	if !strings.Contains(cloneUrl, "://") {
+		if strings.HasPrefix(cloneUrl, "/") || strings.HasPrefix(cloneUrl, ".") {
+			return cloneUrl
+		}
+		match := scpLike.FindStringSubmatch(cloneUrl)
+		if match == nil {
+			return ""
+		}
+		return canonical(match[1], match[2])
+	}
+
+	parsed, err := url.Parse(cloneUrl)
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "https", "http":
+		return canonical(parsed.Host, parsed.Path)
+	case "ssh", "git", "git+ssh", "ssh+git":
+		// The SSH port doesn't apply to https.
+		return canonical(parsed.Hostname(), parsed.Path)
+	case "file":
+		return "file://" + parsed.Path
+	}
+	return ""
+}
+
+func canonical(host, path string) string {
+	host = strings.ToLower(host)
+	path = strings.Trim(path, "/")
+	path = strings.TrimSuffix(path, ".git")
+	if host == "" || path == "" {
+		return ""
+	}
+	return "https://" + host + "/" + path
+}
@@ -0,0 +1,151 @@
+// Package logging configures synq-dbt's own log output, which shares the
+// terminal with dbt's.
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// FormatEnv selects the log format, FormatText or FormatJSON.
+	FormatEnv = "SYNQ_LOG_FORMAT"
+	// LevelEnv selects the lowest level logged: trace, debug, info, warn or
+	// error.
+	LevelEnv = "SYNQ_LOG_LEVEL"
+	// QuietEnv, when true, logs warnings and errors only, regardless of
+	// LevelEnv.
+	QuietEnv = "SYNQ_QUIET"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options of the log output.
+type Options struct {
+	Format string
+	Level  logrus.Level
+	Quiet  bool
+
+	// invalid describes ignored environment values, logged by ApplyEnv
+	// once the format is in place.
+	invalid []string
+}
+
+// OptionsFromEnv reads the options from the environment, warning about and
+// ignoring invalid values.
+func OptionsFromEnv() Options {
+	options := Options{Format: FormatText, Level: logrus.InfoLevel}
+
+	switch format := strings.ToLower(strings.TrimSpace(os.Getenv(FormatEnv))); format {
+	case "", FormatText:
+	case FormatJSON:
+		options.Format = FormatJSON
+	default:
+		options.invalid = append(options.invalid, fmt.Sprintf("ignoring %s=%q (must be text or json)", FormatEnv, format))
+	}
+	if value := strings.TrimSpace(os.Getenv(LevelEnv)); value != "" {
+		if level, err := logrus.ParseLevel(value); err == nil {
+			options.Level = level
+		} else {
+			options.invalid = append(options.invalid, fmt.Sprintf("ignoring %s=%q (must be trace, debug, info, warn or error)", LevelEnv, value))
+		}
+	}
+	if value := strings.TrimSpace(os.Getenv(QuietEnv)); value != "" {
+		if quiet, err := strconv.ParseBool(value); err == nil {
+			options.Quiet = quiet
+		} else {
+			options.invalid = append(options.invalid, fmt.Sprintf("ignoring %s=%q (must be true or false)", QuietEnv, value))
+		}
+	}
+	return options
+}
+
+// Apply configures the standard logger.
+func Apply(options Options) {
+	apply(logrus.StandardLogger(), options)
+}
+
+func apply(logger *logrus.Logger, options Options) {
+	if options.Format == FormatJSON {
+		logger.SetFormatter(&logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+	} else {
+		logger.SetFormatter(&TextFormatter{})
+	}
+
+	level := options.Level
+	if options.Quiet && level > logrus.WarnLevel {
+		level = logrus.WarnLevel
+	}
+	logger.SetLevel(level)
+}
+
+// ApplyEnv configures the standard logger from the environment, see
+// OptionsFromEnv.
+func ApplyEnv() {
+	options := OptionsFromEnv()
+	Apply(options)
+	for _, message := range options.invalid {
+		logrus.Warn("synq-dbt " + message)
+	}
+}
+
+// SetQuiet switches quiet mode on, e.g. for --synq-quiet.
+func SetQuiet() {
+	if logrus.GetLevel() > logrus.WarnLevel {
+		logrus.SetLevel(logrus.WarnLevel)
+	}
+}
+
+// TextFormatter keeps the wrapper's historical "15:04:05  message" lines,
+// adds the level where it isn't info, and appends the fields as key=value.
+type TextFormatter struct{}
+
+func (f *TextFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(entry.Time.Format("15:04:05"))
+	b.WriteString("  ")
+	if entry.Level != logrus.InfoLevel {
+		b.WriteString(strings.ToUpper(entry.Level.String()))
+		b.WriteString(" ")
+	}
+	b.WriteString(entry.Message)
+
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b.WriteString(" ")
+		writeField(&b, key, entry.Data[key])
+	}
+	b.WriteString("\n")
+	return b.Bytes(), nil
+}
+
+func writeField(w io.Writer, key string, value interface{}) {
+	var s string
+	switch v := value.(type) {
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " \"=\t\n") {
+		s = strconv.Quote(s)
+	}
+	fmt.Fprintf(w, "%s=%s", key, s)
+}
@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestOptionsFromEnv(t *testing.T) {
+	tests := map[string]struct {
+		env     map[string]string
+		want    Options
+		invalid int
+	}{
+		"defaults": {
+			want: Options{Format: FormatText, Level: logrus.InfoLevel},
+		},
+		"json debug": {
+			env:  map[string]string{FormatEnv: "JSON", LevelEnv: "debug"},
+			want: Options{Format: FormatJSON, Level: logrus.DebugLevel},
+		},
+		"quiet": {
+			env:  map[string]string{QuietEnv: "1"},
+			want: Options{Format: FormatText, Level: logrus.InfoLevel, Quiet: true},
+		},
+		"invalid": {
+			env:     map[string]string{FormatEnv: "xml", LevelEnv: "loud", QuietEnv: "maybe"},
+			want:    Options{Format: FormatText, Level: logrus.InfoLevel},
+			invalid: 3,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range []string{FormatEnv, LevelEnv, QuietEnv} {
+				t.Setenv(key, tt.env[key])
+			}
+			got := OptionsFromEnv()
+			if len(got.invalid) != tt.invalid {
+				t.Errorf("invalid = %v, want %d messages", got.invalid, tt.invalid)
+			}
+			got.invalid = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("OptionsFromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&out)
+
+	apply(logger, Options{Format: FormatJSON, Level: logrus.DebugLevel, Quiet: true})
+	logger.Info("synq-dbt hidden")
+	logger.WithFields(logrus.Fields{"attempt": 2, "endpoint": "https://developer.synq.io/"}).Warn("synq-dbt upload failed")
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("expected a single JSON line, got %q: %v", out.String(), err)
+	}
+	if line["level"] != "warning" || line["msg"] != "synq-dbt upload failed" || line["attempt"] != float64(2) {
+		t.Errorf("unexpected line %v", line)
+	}
+	if _, err := time.Parse(time.RFC3339, line["time"].(string)); err != nil {
+		t.Errorf("time is not RFC3339: %v", err)
+	}
+}
+
+func TestTextFormatter(t *testing.T) {
+	entry := &logrus.Entry{
+		Time:    time.Date(2024, 5, 1, 13, 4, 5, 0, time.UTC),
+		Level:   logrus.WarnLevel,
+		Message: "synq-dbt upload failed",
+		Data: logrus.Fields{
+			"error":    errors.New("connection refused"),
+			"attempt":  1,
+			"endpoint": "https://developer.synq.io/",
+		},
+	}
+	got, err := (&TextFormatter{}).Format(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `13:04:05  WARNING synq-dbt upload failed attempt=1 endpoint=https://developer.synq.io/ error="connection refused"` + "\n"
+	if string(got) != want {
+		t.Errorf("Format() = %q, want %q", got, want)
+	}
+
+	entry.Level, entry.Data = logrus.InfoLevel, nil
+	got, _ = (&TextFormatter{}).Format(entry)
+	if string(got) != "13:04:05  synq-dbt upload failed\n" {
+		t.Errorf("Format() = %q", got)
+	}
+}
@@ -9,8 +9,8 @@ import (
 
 	"github.com/getsynq/synq-dbt/build"
 	"github.com/getsynq/synq-dbt/cmd"
+	"github.com/getsynq/synq-dbt/logging"
 	"github.com/sirupsen/logrus"
-	easy "github.com/t-tomalak/logrus-easy-formatter"
 )
 
 //go:generate bash bin/version.sh
@@ -23,26 +23,22 @@ func main() {
 	go func() {
 		select {
 		case sig := <-ch:
-			logrus.Printf("synq-dbt received %s signal, shutting down", sig.String())
+			logrus.WithField("signal", sig.String()).Info("synq-dbt received signal, shutting down")
 			cancel()
 		case <-ctx.Done():
 		}
 	}()
 	defer cancel()
 
-	logrus.SetFormatter(&easy.Formatter{
-		TimestampFormat: "15:04:05",
-		LogFormat:       "%time%  %msg%\n",
-	})
+	logging.ApplyEnv()
 
-	logrus.Printf(
-		"synq-dbt %s (%s) started (pid %d pgrp %d ppid %d)",
-		strings.TrimSpace(build.Version),
-		strings.TrimSpace(build.Time),
-		os.Getpid(),
-		syscall.Getpgrp(),
-		syscall.Getppid(),
-	)
+	logrus.WithFields(logrus.Fields{
+		"version":    strings.TrimSpace(build.Version),
+		"build_time": strings.TrimSpace(build.Time),
+		"pid":        os.Getpid(),
+		"pgrp":       syscall.Getpgrp(),
+		"ppid":       syscall.Getppid(),
+	}).Info("synq-dbt started")
 
 	cmd.Execute(ctx)
 }
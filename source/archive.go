@@ -0,0 +1,149 @@
+package source
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// openTarGz reads the archive twice: once to find the target directory, and
+// once to keep only the JSON files directly in it in memory. Compiled SQL,
+// partial_parse.msgpack and other large files are never buffered.
+func openTarGz(archivePath string) (*Source, error) {
+	var names []string
+	err := readTarGz(archivePath, func(name string, _ *tar.Header, _ io.Reader) error {
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	dir, ok := locateTargetDir(names)
+	if !ok {
+		return nil, fmt.Errorf("no dbt artifacts found in %s", archivePath)
+	}
+
+	files := memFS{}
+	err = readTarGz(archivePath, func(name string, header *tar.Header, content io.Reader) error {
+		if path.Dir(name) != dir || path.Ext(name) != ".json" {
+			return nil
+		}
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return fmt.Errorf("reading %s from %s: %w", header.Name, archivePath, err)
+		}
+		files[name] = memFile{content: data, modTime: header.ModTime}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return subTargetDir(files, names, archivePath, nil)
+}
+
+// readTarGz calls fn for every regular file of a .tar.gz archive, with its
+// cleaned name.
+func readTarGz(archivePath string, fn func(name string, header *tar.Header, content io.Reader) error) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", archivePath, err)
+	}
+	defer func() { _ = gz.Close() }()
+
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", archivePath, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(strings.TrimPrefix(path.Clean(header.Name), "./"), header, reader); err != nil {
+			return err
+		}
+	}
+}
+
+func openZip(archivePath string) (*Source, error) {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", archivePath, err)
+	}
+
+	names := make([]string, 0, len(reader.File))
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	source, err := subTargetDir(reader, names, archivePath, reader)
+	if err != nil {
+		_ = reader.Close()
+	}
+	return source, err
+}
+
+func subTargetDir(fsys fs.FS, names []string, archivePath string, closer io.Closer) (*Source, error) {
+	dir, ok := locateTargetDir(names)
+	if !ok {
+		return nil, fmt.Errorf("no dbt artifacts found in %s", archivePath)
+	}
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Source{FS: sub, Location: path.Join(archivePath, dir), closer: closer}, nil
+}
+
+// memFS is a read-only in-memory file system of regular files, keyed by
+// slash-separated path.
+type memFS map[string]memFile
+
+type memFile struct {
+	content []byte
+	modTime time.Time
+}
+
+func (m memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	file, ok := m[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &openMemFile{name: name, memFile: file, Reader: bytes.NewReader(file.content)}, nil
+}
+
+type openMemFile struct {
+	*bytes.Reader
+	memFile
+	name string
+}
+
+func (f *openMemFile) Stat() (fs.FileInfo, error) { return f, nil }
+func (f *openMemFile) Close() error               { return nil }
+
+func (f *openMemFile) Name() string       { return path.Base(f.name) }
+func (f *openMemFile) Size() int64        { return int64(len(f.content)) }
+func (f *openMemFile) Mode() fs.FileMode  { return 0o444 }
+func (f *openMemFile) ModTime() time.Time { return f.modTime }
+func (f *openMemFile) IsDir() bool        { return false }
+func (f *openMemFile) Sys() any           { return nil }
@@ -0,0 +1,289 @@
+package source
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty body, all our requests are GETs.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Config describes how to reach an S3-compatible store. It is read from
+// the standard AWS variables so the same setup works for AWS and for e.g. a
+// local MinIO:
+//   - SYNQ_S3_ENDPOINT, AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL: endpoint of
+//     a non-AWS store, addressed path-style (http://localhost:9000/bucket/key)
+//   - AWS_REGION or AWS_DEFAULT_REGION, defaults to us-east-1
+//   - AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN; requests
+//     are sent unsigned when no keys are set
+type s3Config struct {
+	endpoint        string
+	region          string
+	accessKeyId     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+func s3ConfigFromEnv() s3Config {
+	config := s3Config{
+		endpoint:        firstEnv("SYNQ_S3_ENDPOINT", "AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"),
+		region:          firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		accessKeyId:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if config.region == "" {
+		config.region = "us-east-1"
+	}
+	return config
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// openS3 opens s3://bucket/prefix as a target directory. Objects are fetched
+// on first access and kept in memory.
+func openS3(ctx context.Context, from string) (*Source, error) {
+	parsed, err := url.Parse(from)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("%s has no bucket", from)
+	}
+
+	fsys := &s3FS{
+		ctx:    ctx,
+		client: &http.Client{Timeout: 2 * time.Minute},
+		config: s3ConfigFromEnv(),
+		bucket: parsed.Host,
+		prefix: strings.Trim(parsed.Path, "/"),
+		cache:  map[string]*memFile{},
+	}
+
+	// Fail early on a wrong URL or credentials rather than reporting every
+	// artifact as missing.
+	if _, err := fs.Stat(fsys, "manifest.json"); err != nil {
+		if _, runResultsErr := fs.Stat(fsys, "run_results.json"); runResultsErr != nil {
+			if fsys.denied {
+				return nil, fmt.Errorf("no dbt artifacts found at %s, access was denied: check the credentials and the s3:GetObject permission: %w", from, err)
+			}
+			return nil, fmt.Errorf("no dbt artifacts found at %s: %w", from, err)
+		}
+	}
+
+	return &Source{FS: fsys, Location: from}, nil
+}
+
+type s3FS struct {
+	ctx    context.Context
+	client *http.Client
+	config s3Config
+	bucket string
+	prefix string
+
+	mu    sync.Mutex
+	cache map[string]*memFile // nil value caches a missing object
+	// denied is set once a GET was answered with 403 Forbidden.
+	denied bool
+}
+
+func (s *s3FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, cached := s.cache[name]
+	if !cached {
+		var err error
+		file, err = s.get(path.Join(s.prefix, name))
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		s.cache[name] = file
+	}
+	if file == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return memFS{name: *file}.Open(name)
+}
+
+// get downloads an object, returning nil for objects that do not exist.
+// Without s3:ListBucket AWS answers 403 instead of 404 for a missing key,
+// so a 403 counts as missing too.
+func (s *s3FS) get(key string) (*memFile, error) {
+	request, err := http.NewRequestWithContext(s.ctx, http.MethodGet, s.objectUrl(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	signS3Request(request, s.config, time.Now().UTC())
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	case http.StatusForbidden:
+		s.denied = true
+		return nil, nil
+	default:
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return nil, fmt.Errorf("GET s3://%s/%s: %s: %s", s.bucket, key, response.Status, strings.TrimSpace(string(body)))
+	}
+
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	modTime, _ := http.ParseTime(response.Header.Get("Last-Modified"))
+	return &memFile{content: content, modTime: modTime}, nil
+}
+
+func (s *s3FS) objectUrl(key string) string {
+	if s.config.endpoint != "" {
+		return strings.TrimSuffix(s.config.endpoint, "/") + "/" + s.bucket + "/" + uriEncode(key, false)
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, s.config.region, uriEncode(key, false))
+}
+
+// signS3Request signs a body-less request with AWS Signature Version 4.
+func signS3Request(request *http.Request, config s3Config, now time.Time) {
+	request.Header.Set("x-amz-content-sha256", emptyPayloadHash)
+	if config.accessKeyId == "" || config.secretAccessKey == "" {
+		return
+	}
+
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	request.Header.Set("x-amz-date", amzDate)
+	if config.sessionToken != "" {
+		request.Header.Set("x-amz-security-token", config.sessionToken)
+	}
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		uriEncode(request.URL.Path, false),
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := date + "/" + config.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hexSha256(canonicalRequest),
+	}, "\n")
+
+	signingKey := deriveSigningKey(config.secretAccessKey, date, config.region, "s3")
+	signature := hex.EncodeToString(hmacSha256(signingKey, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		config.accessKeyId,
+		scope,
+		signedHeaders,
+		signature,
+	))
+}
+
+func deriveSigningKey(secret, date, region, service string) []byte {
+	key := hmacSha256([]byte("AWS4"+secret), date)
+	key = hmacSha256(key, region)
+	key = hmacSha256(key, service)
+	return hmacSha256(key, "aws4_request")
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hexSha256(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters, as
+// SigV4 requires. Slashes are kept unless encodeSlash is set.
+func uriEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			encoded.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
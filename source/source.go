@@ -0,0 +1,83 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// Source is a dbt target directory opened for reading, wherever it lives:
+// on local disk, inside an archive, or in S3-compatible object storage.
+// Artifact names are relative to the target directory, e.g. "manifest.json".
+type Source struct {
+	fs.FS
+	// Location describes where the target directory was found, for logs.
+	Location string
+	closer   io.Closer
+}
+
+// Close releases the resources held by the source.
+func (s *Source) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// Open opens the target directory described by from, which is one of
+//   - a local directory
+//   - a .tar.gz / .tgz or .zip archive of a target directory
+//   - an s3://bucket/prefix URL of an S3-compatible store (see openS3)
+func Open(ctx context.Context, from string) (*Source, error) {
+	if strings.HasPrefix(from, "s3://") {
+		return openS3(ctx, from)
+	}
+
+	info, err := os.Stat(from)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &Source{FS: os.DirFS(from), Location: from}, nil
+	}
+
+	lower := strings.ToLower(from)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return openTarGz(from)
+	case strings.HasSuffix(lower, ".zip"):
+		return openZip(from)
+	}
+	return nil, fmt.Errorf("%s is neither a directory nor a .tar.gz, .tgz or .zip archive", from)
+}
+
+// artifactMarkers identify a dbt target directory inside an archive.
+var artifactMarkers = map[string]bool{
+	"manifest.json":    true,
+	"run_results.json": true,
+	"catalog.json":     true,
+	"sources.json":     true,
+}
+
+// locateTargetDir returns the shallowest directory among the archive entry
+// names that holds a dbt artifact, so that archives of a target directory
+// work whether they were created from inside it (manifest.json at the root)
+// or from the project (target/manifest.json).
+func locateTargetDir(names []string) (string, bool) {
+	best, found := "", false
+	for _, name := range names {
+		name = strings.TrimPrefix(path.Clean(name), "./")
+		if !artifactMarkers[path.Base(name)] {
+			continue
+		}
+		dir := path.Dir(name)
+		if !found || strings.Count(dir, "/") < strings.Count(best, "/") || (dir == "." && best != ".") {
+			best, found = dir, true
+		}
+	}
+	return best, found
+}
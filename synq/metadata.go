@@ -0,0 +1,50 @@
+package synq
+
+// Keys of wrapper-side metadata sent in IngestInvocationRequest.EnvironmentVars.
+const (
+	// MetadataRunId is the wrapper run id, see RunId.
+	MetadataRunId = RunIdEnv
+	// MetadataTags holds the user-defined tags as a JSON object.
+	MetadataTags = TagsEnv
+
+	// MetadataInvocationKind is one of the InvocationKind* values.
+	MetadataInvocationKind = "SYNQ_INVOCATION_KIND"
+	// MetadataProduction is "false" for invocations which don't describe
+	// what runs in production, see InvocationKindPreMerge.
+	MetadataProduction = "SYNQ_PRODUCTION"
+
+	// MetadataInvocationId is the dbt invocation_id of the artifacts.
+	MetadataInvocationId = "SYNQ_INVOCATION_ID"
+
+	// MetadataPartialRunResults is "true" when run_results.json was
+	// synthesized from dbt's output because dbt never wrote it.
+	MetadataPartialRunResults = "SYNQ_PARTIAL_RUN_RESULTS"
+
+	// MetadataInvocationIdPolicy is the dbt.InvocationIdPolicy that was applied.
+	MetadataInvocationIdPolicy = "SYNQ_INVOCATION_ID_POLICY"
+	// MetadataInvocationIdCheck is "consistent" when all artifacts shared one
+	// invocation_id, "mismatch" otherwise.
+	MetadataInvocationIdCheck = "SYNQ_INVOCATION_ID_CHECK"
+	// MetadataInvocationIdMismatched lists mismatched artifacts as
+	// comma-separated name=invocation_id pairs.
+	MetadataInvocationIdMismatched = "SYNQ_INVOCATION_ID_MISMATCHED"
+	// MetadataInvocationIdSplitFrom is the invocation_id of the run that split
+	// artifacts were collected with.
+	MetadataInvocationIdSplitFrom = "SYNQ_INVOCATION_ID_SPLIT_FROM"
+
+	// MetadataBackfill holds the artifact sets a synq_backfill upload was read
+	// from, comma-separated. Such uploads describe historical runs and carry
+	// no git context.
+	MetadataBackfill = "SYNQ_BACKFILL"
+)
+
+// Kinds of uploaded invocations.
+const (
+	// InvocationKindRun is a dbt run, wrapped or uploaded afterwards.
+	InvocationKindRun = "run"
+	// InvocationKindBackfill is a historical run uploaded by synq_backfill.
+	InvocationKindBackfill = "backfill"
+	// InvocationKindPreMerge is the manifest of a pull request uploaded by
+	// synq_parse, to show the impact of a change before it merges.
+	InvocationKindPreMerge = "pre_merge"
+)
@@ -2,10 +2,16 @@ package synq
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
 
 	ingestdbtv1 "buf.build/gen/go/getsynq/api/protocolbuffers/go/synq/ingest/dbt/v1"
 	"github.com/getsynq/synq-dbt/dbt"
 	"github.com/getsynq/synq-dbt/git"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
 )
 
 // RequestBuilder helps construct an IngestInvocationRequest.
@@ -30,41 +36,124 @@ func (b *RequestBuilder) WithArtifacts(artifacts *dbt.Artifacts) *RequestBuilder
 	if len(artifacts.Manifest) > 0 {
 		dbtArtifacts = append(dbtArtifacts, &ingestdbtv1.DbtArtifact{
 			Artifact: &ingestdbtv1.DbtArtifact_ManifestJson{
-				ManifestJson: []byte(artifacts.Manifest),
+				ManifestJson: artifacts.Manifest,
 			},
 		})
 	}
 	if len(artifacts.RunResults) > 0 {
 		dbtArtifacts = append(dbtArtifacts, &ingestdbtv1.DbtArtifact{
 			Artifact: &ingestdbtv1.DbtArtifact_RunResultsJson{
-				RunResultsJson: []byte(artifacts.RunResults),
+				RunResultsJson: artifacts.RunResults,
 			},
 		})
 	}
 	if len(artifacts.Sources) > 0 {
 		dbtArtifacts = append(dbtArtifacts, &ingestdbtv1.DbtArtifact{
 			Artifact: &ingestdbtv1.DbtArtifact_SourcesJson{
-				SourcesJson: []byte(artifacts.Sources),
+				SourcesJson: artifacts.Sources,
 			},
 		})
 	}
 	if len(artifacts.Catalog) > 0 {
 		dbtArtifacts = append(dbtArtifacts, &ingestdbtv1.DbtArtifact{
 			Artifact: &ingestdbtv1.DbtArtifact_CatalogJson{
-				CatalogJson: []byte(artifacts.Catalog),
+				CatalogJson: artifacts.Catalog,
 			},
 		})
 	}
+	for _, file := range artifacts.Files {
+		if artifact := fileArtifact(file); artifact != nil {
+			dbtArtifacts = append(dbtArtifacts, artifact)
+		} else {
+			logrus.Debugf("synq-dbt %s is not supported by the SYNQ ingest API, skipping", file.Name)
+		}
+	}
 	b.request.Artifacts = dbtArtifacts
+
+	if artifacts.InvocationId != "" {
+		b.WithMetadata(MetadataInvocationId, artifacts.InvocationId)
+	}
+	if artifacts.PartialRunResults {
+		b.WithMetadata(MetadataPartialRunResults, "true")
+	}
+	if check := artifacts.InvocationIdCheck; check != nil {
+		b.withInvocationIdCheck(check)
+	}
 	return b
 }
 
+func (b *RequestBuilder) withInvocationIdCheck(check *dbt.InvocationIdCheck) {
+	b.WithMetadata(MetadataInvocationIdPolicy, string(check.Policy))
+	if check.SplitFrom != "" {
+		b.WithMetadata(MetadataInvocationIdSplitFrom, check.SplitFrom)
+	}
+	if check.Consistent() {
+		b.WithMetadata(MetadataInvocationIdCheck, "consistent")
+		return
+	}
+
+	mismatched := make([]string, 0, len(check.Mismatched))
+	for name, invocationId := range check.Mismatched {
+		mismatched = append(mismatched, name+"="+invocationId)
+	}
+	sort.Strings(mismatched)
+	b.WithMetadata(MetadataInvocationIdCheck, "mismatch")
+	b.WithMetadata(MetadataInvocationIdMismatched, strings.Join(mismatched, ","))
+}
+
+// fileArtifact maps an optional collected file onto the DbtArtifact kind the
+// ingest API accepts for it, or returns nil when there is none.
+func fileArtifact(file dbt.ArtifactFile) *ingestdbtv1.DbtArtifact {
+	switch file.Name {
+	case "semantic_manifest.json":
+		return &ingestdbtv1.DbtArtifact{
+			Artifact: &ingestdbtv1.DbtArtifact_SemanticManifestJson{
+				SemanticManifestJson: file.Content,
+			},
+		}
+	}
+	return nil
+}
+
 // WithEnvVars adds environment variables to the request.
 func (b *RequestBuilder) WithEnvVars(envVars map[string]string) *RequestBuilder {
-	b.request.EnvironmentVars = envVars
+	for name, value := range envVars {
+		b.WithMetadata(name, value)
+	}
 	return b
 }
 
+// WithMetadata adds a single entry to the request's environment variables.
+// The ingest API has no dedicated fields for wrapper-side metadata, so it
+// travels alongside the collected environment under SYNQ_* keys.
+func (b *RequestBuilder) WithMetadata(key, value string) *RequestBuilder {
+	if b.request.EnvironmentVars == nil {
+		b.request.EnvironmentVars = map[string]string{}
+	}
+	b.request.EnvironmentVars[key] = value
+	return b
+}
+
+// WithRunId adds the wrapper run id, see RunId.
+func (b *RequestBuilder) WithRunId(runId string) *RequestBuilder {
+	if runId == "" {
+		return b
+	}
+	return b.WithMetadata(MetadataRunId, runId)
+}
+
+// WithTags adds user-defined key/value tags, see Tags.
+func (b *RequestBuilder) WithTags(tags map[string]string) *RequestBuilder {
+	if len(tags) == 0 {
+		return b
+	}
+	encoded, err := json.Marshal(tags)
+	if err != nil {
+		return b
+	}
+	return b.WithMetadata(MetadataTags, string(encoded))
+}
+
 // WithUploaderInfo adds uploader version and build time.
 func (b *RequestBuilder) WithUploaderInfo(version, buildTime string) *RequestBuilder {
 	b.request.UploaderVersion = version
@@ -97,11 +186,134 @@ func (b *RequestBuilder) WithExitCode(exitCode int) *RequestBuilder {
 }
 
 // WithGitContext collects and adds git context from the specified directory.
+// Details the GitContext has no fields for are added as SYNQ_GIT_* metadata.
 func (b *RequestBuilder) WithGitContext(ctx context.Context, dir string) *RequestBuilder {
-	b.request.GitContext = git.CollectGitContext(ctx, dir)
+	return b.WithCollectedGitContext(git.Collect(ctx, dir))
+}
+
+// WithCollectedGitContext adds a git context collected earlier, see
+// WithGitContext.
+func (b *RequestBuilder) WithCollectedGitContext(gitContext *git.Context) *RequestBuilder {
+	b.request.GitContext = gitContext.Proto()
+	for key, value := range gitContext.Metadata() {
+		b.WithMetadata(key, value)
+	}
+	return b
+}
+
+// WithInvocationKind adds the kind of the invocation, one of the
+// InvocationKind* values. Pre-merge invocations are marked as not
+// describing production.
+func (b *RequestBuilder) WithInvocationKind(kind string) *RequestBuilder {
+	b.WithMetadata(MetadataInvocationKind, kind)
+	if kind == InvocationKindPreMerge {
+		b.WithMetadata(MetadataProduction, "false")
+	}
+	return b
+}
+
+// WithPullRequest adds the pull or merge request under SYNQ_PR_* keys.
+func (b *RequestBuilder) WithPullRequest(pr *git.PullRequest) *RequestBuilder {
+	for key, value := range pr.Metadata() {
+		b.WithMetadata(key, value)
+	}
 	return b
 }
 
+// ChangedFiles are the dbt files changed on a pull or merge request.
+type ChangedFiles struct {
+	// BaseRef is the ref Files were listed against.
+	BaseRef string
+	Files   []string
+	// Truncated is set when there were more than git.MaxDiffFiles files.
+	Truncated bool
+}
+
+// ListChangedFiles lists the dbt files in dir changed since the base ref of
+// a pull or merge request, see git.BaseRef. It returns nil outside pull and
+// merge requests or when the files can't be listed. The files are listed
+// once per project and added to each of its invocations with
+// WithChangedFiles.
+func ListChangedFiles(ctx context.Context, dir string) *ChangedFiles {
+	baseRef := git.BaseRef()
+	if baseRef == "" {
+		return nil
+	}
+	files, err := git.ChangedFiles(ctx, dir, baseRef)
+	if err != nil {
+		logrus.WithError(err).WithField("base_ref", baseRef).Warn("synq-dbt could not list changed files")
+		return nil
+	}
+
+	changed := &ChangedFiles{BaseRef: baseRef, Files: files}
+	if len(files) > git.MaxDiffFiles {
+		changed.Files = files[:git.MaxDiffFiles]
+		changed.Truncated = true
+	}
+	logrus.WithFields(logrus.Fields{"base_ref": baseRef, "files": len(files)}).Info("synq-dbt listed changed files")
+	return changed
+}
+
+// WithChangedFiles adds the changed files, each with the ids of the manifest
+// nodes defined in it. It does nothing without changed files or without a
+// manifest to look the nodes up in. Files are dropped from the end until the
+// JSON fits in maxSize bytes, 0 means no limit.
+func (b *RequestBuilder) WithChangedFiles(changed *ChangedFiles, artifacts *dbt.Artifacts, maxSize int) *RequestBuilder {
+	if changed == nil || artifacts == nil || len(artifacts.Manifest) == 0 {
+		return b
+	}
+
+	nodes := artifacts.NodesByFile()
+	encode := func(files []string) string {
+		diff := make(map[string][]string, len(files))
+		for _, file := range files {
+			diff[file] = nodes[file]
+			if diff[file] == nil {
+				diff[file] = []string{}
+			}
+		}
+		encoded, _ := json.Marshal(diff)
+		return string(encoded)
+	}
+
+	files := changed.Files
+	encoded := encode(files)
+	truncated := changed.Truncated
+	if maxSize > 0 && len(encoded) > maxSize {
+		// The encoding grows with every file, so the longest prefix
+		// that fits can be searched for.
+		fits := sort.Search(len(files), func(n int) bool {
+			return len(encode(files[:n+1])) > maxSize
+		})
+		encoded = encode(files[:fits])
+		truncated = true
+	}
+	if truncated {
+		b.WithMetadata(git.DiffTruncatedKey, "true")
+	}
+	return b.
+		WithMetadata(git.BaseRefKey, changed.BaseRef).
+		WithMetadata(git.DiffKey, encoded)
+}
+
+// DescribeRequest summarizes a request for logs.
+func DescribeRequest(request *ingestdbtv1.IngestInvocationRequest) string {
+	artifactBytes := 0
+	for _, artifact := range request.GetArtifacts() {
+		artifactBytes += proto.Size(artifact)
+	}
+	return fmt.Sprintf(
+		"%d artifacts (%d bytes), %d environment entries, %d bytes of stdout, %d bytes of stderr, exit code %d, args %q",
+		len(request.GetArtifacts()),
+		artifactBytes,
+		len(request.GetEnvironmentVars()),
+		len(request.GetStdOut()),
+		len(request.GetStdErr()),
+		request.GetExitCode(),
+		request.GetArgs(),
+	)
+}
+
 // Build returns the constructed IngestInvocationRequest.
 func (b *RequestBuilder) Build() *ingestdbtv1.IngestInvocationRequest {
 	return b.request
@@ -0,0 +1,83 @@
+package synq
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/getsynq/synq-dbt/dbt"
+	"github.com/getsynq/synq-dbt/git"
+)
+
+const changedFilesManifest = `{
+	"metadata": {"project_name": "shop"},
+	"nodes": {
+		"model.shop.orders": {"unique_id": "model.shop.orders", "package_name": "shop", "original_file_path": "models/orders.sql"}
+	}
+}`
+
+func TestRequestBuilder_WithChangedFiles(t *testing.T) {
+	changed := &ChangedFiles{BaseRef: "main", Files: []string{"models/orders.sql", "models/customers.sql"}}
+	artifacts := &dbt.Artifacts{Manifest: []byte(changedFilesManifest)}
+
+	request := NewRequestBuilder().WithChangedFiles(changed, artifacts, 0).Build()
+	if got, want := request.EnvironmentVars[git.DiffKey], `{"models/customers.sql":[],"models/orders.sql":["model.shop.orders"]}`; got != want {
+		t.Errorf("%s = %q, want %q", git.DiffKey, got, want)
+	}
+	if got := request.EnvironmentVars[git.BaseRefKey]; got != "main" {
+		t.Errorf("%s = %q, want main", git.BaseRefKey, got)
+	}
+	if _, ok := request.EnvironmentVars[git.DiffTruncatedKey]; ok {
+		t.Errorf("%s set without truncation", git.DiffTruncatedKey)
+	}
+}
+
+func TestRequestBuilder_WithChangedFilesWithoutManifest(t *testing.T) {
+	changed := &ChangedFiles{BaseRef: "main", Files: []string{"models/orders.sql"}}
+
+	for name, artifacts := range map[string]*dbt.Artifacts{
+		"nil":         nil,
+		"no manifest": {RunResults: []byte(`{}`)},
+	} {
+		request := NewRequestBuilder().WithChangedFiles(changed, artifacts, 0).Build()
+		if len(request.EnvironmentVars) != 0 {
+			t.Errorf("%s: environment = %v, want none", name, request.EnvironmentVars)
+		}
+	}
+	if request := NewRequestBuilder().WithChangedFiles(nil, &dbt.Artifacts{Manifest: []byte(changedFilesManifest)}, 0).Build(); len(request.EnvironmentVars) != 0 {
+		t.Errorf("no changed files: environment = %v, want none", request.EnvironmentVars)
+	}
+}
+
+func TestRequestBuilder_WithChangedFilesCapped(t *testing.T) {
+	changed := &ChangedFiles{BaseRef: "main", Files: []string{"models/orders.sql", "models/customers.sql", "models/payments.sql"}}
+	artifacts := &dbt.Artifacts{Manifest: []byte(changedFilesManifest)}
+
+	request := NewRequestBuilder().WithChangedFiles(changed, artifacts, 70).Build()
+	if got, want := request.EnvironmentVars[git.DiffKey], `{"models/customers.sql":[],"models/orders.sql":["model.shop.orders"]}`; got != want {
+		t.Errorf("%s = %q, want %q", git.DiffKey, got, want)
+	}
+	if got := request.EnvironmentVars[git.DiffTruncatedKey]; got != "true" {
+		t.Errorf("%s = %q, want true", git.DiffTruncatedKey, got)
+	}
+}
+
+func TestRequestBuilder_WithChangedFilesDefaultLimit(t *testing.T) {
+	changed := &ChangedFiles{BaseRef: "main"}
+	for i := 0; i < 200; i++ {
+		changed.Files = append(changed.Files, fmt.Sprintf("models/marts/finance/fct_revenue_by_region_%03d.sql", i))
+	}
+	artifacts := &dbt.Artifacts{Manifest: []byte(changedFilesManifest)}
+
+	request := NewRequestBuilder().WithChangedFiles(changed, artifacts, git.MaxDiffSize).Build()
+	var diff map[string][]string
+	if err := json.Unmarshal([]byte(request.EnvironmentVars[git.DiffKey]), &diff); err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != len(changed.Files) {
+		t.Errorf("got %d files, want all %d", len(diff), len(changed.Files))
+	}
+	if _, ok := request.EnvironmentVars[git.DiffTruncatedKey]; ok {
+		t.Errorf("%s set below the default limit", git.DiffTruncatedKey)
+	}
+}
@@ -0,0 +1,58 @@
+package synq
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RunIdEnv carries the wrapper run id. It is set for dbt and read back when
+// present, so a retried task or an outer wrapper can provide its own.
+const RunIdEnv = "SYNQ_RUN_ID"
+
+// RunId returns the id of the current wrapped run: SYNQ_RUN_ID when set,
+// a new random UUID otherwise. Unlike dbt's invocation_id it exists even
+// when dbt fails before writing any artifact.
+func RunId() string {
+	if runId := strings.TrimSpace(os.Getenv(RunIdEnv)); runId != "" {
+		return runId
+	}
+	return NewRunId()
+}
+
+// randRead is crypto/rand.Read, replaced in tests.
+var randRead = rand.Read
+
+// NewRunId returns a random (version 4) UUID. Should the system's random
+// source fail, it falls back to a time-based id rather than keeping dbt
+// from running.
+func NewRunId() string {
+	var id [16]byte
+	if _, err := randRead(id[:]); err != nil {
+		logrus.Warnf("synq-dbt crypto/rand failed, using a time-based run id: %v", err)
+		return timeRunId(time.Now(), os.Getpid())
+	}
+	id[6] = id[6]&0x0f | 0x40
+	return formatUuid(id)
+}
+
+// timeRunId returns a version 7 UUID made of the Unix time in milliseconds,
+// the sub-millisecond nanoseconds and pid.
+func timeRunId(now time.Time, pid int) string {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[0:8], uint64(now.UnixMilli())<<16|uint64(now.Nanosecond()%1e6>>8))
+	binary.BigEndian.PutUint32(id[8:12], uint32(now.Nanosecond()))
+	binary.BigEndian.PutUint32(id[12:16], uint32(pid))
+	id[6] = id[6]&0x0f | 0x70
+	return formatUuid(id)
+}
+
+func formatUuid(id [16]byte) string {
+	id[8] = id[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
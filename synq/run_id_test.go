@@ -0,0 +1,42 @@
+package synq
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunId(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	t.Setenv(RunIdEnv, "")
+	first, second := RunId(), RunId()
+	if !uuid.MatchString(first) {
+		t.Errorf("RunId() = %q, want a version 4 UUID", first)
+	}
+	if first == second {
+		t.Errorf("RunId() returned %q twice", first)
+	}
+
+	t.Setenv(RunIdEnv, " provided ")
+	if got := RunId(); got != "provided" {
+		t.Errorf("RunId() = %q, want the SYNQ_RUN_ID value", got)
+	}
+}
+
+func TestNewRunId_RandomSourceFails(t *testing.T) {
+	defer func(read func([]byte) (int, error)) { randRead = read }(randRead)
+	randRead = func([]byte) (int, error) { return 0, errors.New("no entropy") }
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if got := NewRunId(); !uuid.MatchString(got) {
+		t.Errorf("NewRunId() = %q, want a version 7 UUID", got)
+	}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	if got := timeRunId(now, 42); !strings.HasPrefix(got, "018df9e2-b27b-7") || !strings.HasSuffix(got, "0000002a") {
+		t.Errorf("timeRunId() = %q", got)
+	}
+}
@@ -0,0 +1,47 @@
+package synq
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TagsEnv holds comma-separated key=value tags added to every invocation.
+const TagsEnv = "SYNQ_TAGS"
+
+// ParseTag parses a single key=value tag. Keys and values are trimmed, the
+// value may be empty but the key may not.
+func ParseTag(tag string) (key, value string, err error) {
+	key, value, ok := strings.Cut(tag, "=")
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if !ok || key == "" {
+		return "", "", fmt.Errorf("invalid tag %q, expected key=value", tag)
+	}
+	return key, value, nil
+}
+
+// Tags merges the tags of SYNQ_TAGS with the given key=value tags, e.g.
+// from --synq-tag flags, which win for keys set in both. Invalid tags are
+// logged and skipped.
+func Tags(tags []string) map[string]string {
+	merged := map[string]string{}
+	add := func(source, tag string) {
+		key, value, err := ParseTag(tag)
+		if err != nil {
+			logrus.Warnf("synq-dbt ignoring %s: %s", source, err.Error())
+			return
+		}
+		merged[key] = value
+	}
+	for _, tag := range strings.Split(os.Getenv(TagsEnv), ",") {
+		if strings.TrimSpace(tag) != "" {
+			add(TagsEnv, tag)
+		}
+	}
+	for _, tag := range tags {
+		add("--synq-tag", tag)
+	}
+	return merged
+}
@@ -0,0 +1,31 @@
+package synq
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTags(t *testing.T) {
+	t.Setenv(TagsEnv, "team=finance, env=prod,,invalid,cost_center=")
+
+	got := Tags([]string{"env=staging", "ticket=DATA-123", "=nokey"})
+	want := map[string]string{
+		"team":        "finance",
+		"env":         "staging",
+		"cost_center": "",
+		"ticket":      "DATA-123",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tags() = %v, want %v", got, want)
+	}
+}
+
+func TestRequestBuilder_WithTags(t *testing.T) {
+	request := NewRequestBuilder().
+		WithTags(map[string]string{"team": "finance", "env": "prod"}).
+		WithTags(nil).
+		Build()
+	if got := request.EnvironmentVars[MetadataTags]; got != `{"env":"prod","team":"finance"}` {
+		t.Errorf("%s = %q", MetadataTags, got)
+	}
+}
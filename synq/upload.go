@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	ingestdbtv1grpc "buf.build/gen/go/getsynq/api/grpc/go/synq/ingest/dbt/v1/dbtv1grpc"
@@ -16,50 +17,127 @@ import (
 	"google.golang.org/grpc/credentials"
 )
 
-func UploadArtifacts(ctx context.Context, request *ingestdbtv1.IngestInvocationRequest, token string, targetDirectory string) {
+// UploadTimeout bounds a single upload attempt. Operators can override at
+// startup via SYNQ_UPLOAD_TIMEOUT (any Go duration string).
+var UploadTimeout = 30 * time.Second
+
+// RetryDelays are the pauses before each retry of a failed upload, their
+// number is the number of retries. Operators can override at startup via
+// SYNQ_UPLOAD_RETRY_DELAYS, a comma-separated list of Go durations; an
+// empty list ("none") disables retries.
+var RetryDelays = []time.Duration{5 * time.Second, 10 * time.Second, 15 * time.Second}
+
+const (
+	uploadTimeoutEnv = "SYNQ_UPLOAD_TIMEOUT"
+	retryDelaysEnv   = "SYNQ_UPLOAD_RETRY_DELAYS"
+)
+
+func init() {
+	ApplyEnv()
+}
+
+// ApplyEnv applies SYNQ_UPLOAD_TIMEOUT and SYNQ_UPLOAD_RETRY_DELAYS, again
+// when they were set after startup, e.g. from synq-dbt.yml.
+func ApplyEnv() {
+	if v := strings.TrimSpace(os.Getenv(uploadTimeoutEnv)); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			UploadTimeout = d
+		} else {
+			logrus.Warnf("ignoring %s=%q (must be a positive Go duration like 30s or 1m)", uploadTimeoutEnv, v)
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv(retryDelaysEnv)); v != "" {
+		if delays, err := parseRetryDelays(v); err == nil {
+			RetryDelays = delays
+		} else {
+			logrus.Warnf("ignoring %s=%q (must be comma-separated Go durations like 5s,10s or none): %v", retryDelaysEnv, v, err)
+		}
+	}
+}
+
+func parseRetryDelays(value string) ([]time.Duration, error) {
+	if strings.EqualFold(value, "none") {
+		return []time.Duration{}, nil
+	}
+	var delays []time.Duration
+	for _, item := range strings.Split(value, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("negative delay %s", d)
+		}
+		delays = append(delays, d)
+	}
+	return delays, nil
+}
+
+// UploadArtifacts sends the request to SYNQ, retrying failed attempts. The
+// returned error is the one of the last attempt; callers wrapping dbt only
+// log it, as the upload must never change the outcome of the run.
+func UploadArtifacts(ctx context.Context, request *ingestdbtv1.IngestInvocationRequest, token string, targetDirectory string) error {
 	if request == nil || token == "" {
-		return
+		return nil
 	}
 
 	endpoint := "https://developer.synq.io/"
-	if envEndpoint, ok := os.LookupEnv("SYNQ_API_ENDPOINT"); ok {
+	if envEndpoint := os.Getenv("SYNQ_API_ENDPOINT"); envEndpoint != "" {
 		endpoint = envEndpoint
 	}
 
-	logrus.Infof("synq-dbt processing `%s`, uploading to `%s`", targetDirectory, endpoint)
+	log := logrus.WithFields(logrus.Fields{
+		"target_dir": targetDirectory,
+		"endpoint":   endpoint,
+	})
+	if invocationId := request.GetEnvironmentVars()[MetadataInvocationId]; invocationId != "" {
+		log = log.WithField("invocation_id", invocationId)
+	}
+	if runId := request.GetEnvironmentVars()[MetadataRunId]; runId != "" {
+		log = log.WithField("run_id", runId)
+	}
+	log.Info("synq-dbt uploading artifacts")
 
-	const (
-		uploadTimeout = 30 * time.Second
-		maxRetries    = 3
-	)
-	retryDelays := []time.Duration{5 * time.Second, 10 * time.Second, 15 * time.Second}
+	uploadTimeout := UploadTimeout
+	retryDelays := RetryDelays
+	maxRetries := len(retryDelays)
 
 	var err error
 	for attempt := 0; attempt <= maxRetries; attempt++ {
+		attemptLog := log.WithFields(logrus.Fields{
+			"attempt":  attempt + 1,
+			"attempts": maxRetries + 1,
+		})
+		start := time.Now()
 		timeoutCtx, cancel := context.WithTimeout(ctx, uploadTimeout)
 		err = ingestInvocation(timeoutCtx, request, token, endpoint)
 		cancel()
+		attemptLog = attemptLog.WithField("duration", time.Since(start).Round(time.Millisecond).String())
 
 		if err == nil {
-			logrus.Info("synq-dbt processing and upload successfully finished")
-			return
+			attemptLog.Info("synq-dbt upload successfully finished")
+			return nil
 		}
 
-		attemptNumber := attempt + 1
-		totalAttempts := maxRetries + 1
 		if errors.Is(err, context.DeadlineExceeded) {
-			logrus.Warnf("synq-dbt upload timed out after %s on attempt %d/%d", uploadTimeout, attemptNumber, totalAttempts)
+			attemptLog.WithField("timeout", uploadTimeout.String()).Warn("synq-dbt upload timed out")
 		} else {
-			logrus.Warnf("synq-dbt upload failed on attempt %d/%d: %s", attemptNumber, totalAttempts, err.Error())
+			attemptLog.WithError(err).Warn("synq-dbt upload failed")
 		}
 
 		if attempt < maxRetries {
-			logrus.Infof("synq-dbt retrying upload in %v...", retryDelays[attempt])
-			time.Sleep(retryDelays[attempt])
+			attemptLog.WithField("retry_in", retryDelays[attempt].String()).Info("synq-dbt retrying upload")
+			select {
+			case <-ctx.Done():
+				log.WithError(ctx.Err()).Error("synq-dbt upload abandoned")
+				return ctx.Err()
+			case <-time.After(retryDelays[attempt]):
+			}
 		}
 	}
 
-	logrus.Errorf("synq-dbt upload failed after %d attempts: %s", maxRetries+1, err.Error())
+	log.WithError(err).WithField("attempts", maxRetries+1).Error("synq-dbt upload failed, giving up")
+	return err
 }
 
 func ingestInvocation(ctx context.Context, request *ingestdbtv1.IngestInvocationRequest, token, endpoint string) error {